@@ -0,0 +1,376 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/* Shell commands which manage tables and change table rows. */
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"column"
+	"constant"
+	"table"
+	"transaction"
+	"st"
+)
+
+// A shell command.
+type Command struct {
+	Usage   string
+	MinArgs int // minimum number of arguments
+	Run     func(sh *Shell, args []string) int
+}
+
+var commands map[string]*Command
+
+func init() {
+	commands = map[string]*Command{
+		"help":       &Command{"help", 0, help},
+		"tables":     &Command{"tables", 0, tables},
+		"columns":    &Command{"columns TABLE", 1, columns},
+		"show":       &Command{"show TABLE", 1, show},
+		"create":     &Command{"create TABLE", 1, create},
+		"drop":       &Command{"drop TABLE", 1, drop},
+		"rename":     &Command{"rename TABLE NEW_NAME", 2, rename},
+		"add":        &Command{"add TABLE COLUMN LENGTH [TYPE]", 3, add},
+		"remove":     &Command{"remove TABLE COLUMN", 2, remove},
+		"versions":   &Command{"versions TABLE", 1, versions},
+		"begin":      &Command{"begin", 0, begin},
+		"insert":     &Command{"insert TABLE COLUMN=VALUE...", 1, insertRow},
+		"update":     &Command{"update TABLE ROW COLUMN=VALUE...", 2, updateRow},
+		"delete":     &Command{"delete TABLE ROW", 2, deleteRow},
+		"commit":     &Command{"commit", 0, commit},
+		"rollback":   &Command{"rollback", 0, rollback},
+		"savepoint":  &Command{"savepoint NAME", 1, savepoint},
+		"rollbackto": &Command{"rollbackto NAME", 1, rollbackTo},
+		"release":    &Command{"release NAME", 1, release},
+		"query":      &Command{"query OPERATION | OPERATION...", 1, nil},
+		"sql":        &Command{"sql STATEMENT", 1, nil},
+		"quit":       &Command{"quit", 0, nil},
+	}
+}
+
+// Prints a description of the status if it is not OK, the error of the transaction tells the table,
+// column and row involved if the transaction has failed with the status.
+func report(status int, tr *transaction.Transaction) {
+	if status == st.OK {
+		return
+	}
+	if tr != nil && tr.Err().HasCode(status) {
+		fmt.Println(tr.Err())
+		return
+	}
+	fmt.Println(st.New(status))
+}
+
+func help(sh *Shell, args []string) int {
+	names := make([]string, 0)
+	for name, _ := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Println("  " + commands[name].Usage)
+	}
+	fmt.Println("Query operations: load TABLE, join ALIAS TABLE COLUMN, hashjoin ALIAS TABLE COLUMN,")
+	fmt.Println("                  leftjoin|rightjoin|fulljoin ALIAS TABLE COLUMN,")
+	fmt.Println("                  select ALIAS OPERATOR VALUE, project ALIAS..., redefine ALIAS NEW_ALIAS,")
+	fmt.Println("                  limit NUMBER, offset NUMBER")
+	return st.OK
+}
+
+// Lists tables and their number of rows.
+func tables(sh *Shell, args []string) int {
+	names := make([]string, 0)
+	for name, _ := range sh.DB.Tables {
+		if !strings.HasPrefix(name, constant.ThePrefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	rows := make([][]string, 0)
+	for _, name := range names {
+		numberOfRows, status := sh.DB.Tables[name].NumberOfRows()
+		if status != st.OK {
+			return status
+		}
+		rows = append(rows, []string{name, strconv.Itoa(numberOfRows)})
+	}
+	printTable([]string{"TABLE", "ROWS"}, rows)
+	return st.OK
+}
+
+// Lists columns of a table.
+func columns(sh *Shell, args []string) int {
+	t, status := sh.DB.Get(args[0])
+	if status != st.OK {
+		return status
+	}
+	rows := make([][]string, 0)
+	for _, c := range t.ColumnsInOrder {
+		if strings.HasPrefix(c.Name, constant.ThePrefix) {
+			continue
+		}
+		indexed := "no"
+		if t.Index(c.Name) != nil {
+			indexed = "yes"
+		}
+		rows = append(rows, []string{c.Name, c.Type, strconv.Itoa(c.Length), indexed})
+	}
+	printTable([]string{"COLUMN", "TYPE", "LENGTH", "INDEXED"}, rows)
+	return st.OK
+}
+
+// Prints all rows of a table, not including deleted rows.
+func show(sh *Shell, args []string) int {
+	t, status := sh.readable(args[0])
+	if status != st.OK {
+		return status
+	}
+	header := []string{"ROW"}
+	for _, c := range t.ColumnsInOrder {
+		if !strings.HasPrefix(c.Name, constant.ThePrefix) {
+			header = append(header, c.Name)
+		}
+	}
+	numberOfRows, status := t.NumberOfRows()
+	if status != st.OK {
+		return status
+	}
+	rows := make([][]string, 0)
+	for i := 0; i < numberOfRows; i++ {
+		row, status := t.Read(i)
+		if status != st.OK {
+			return status
+		}
+		if row["~del"] == "y" {
+			continue
+		}
+		line := []string{strconv.Itoa(i)}
+		for _, name := range header[1:] {
+			line = append(line, row[name])
+		}
+		rows = append(rows, line)
+	}
+	printTable(header, rows)
+	return st.OK
+}
+
+func create(sh *Shell, args []string) int {
+	_, status := sh.DB.Create(args[0])
+	return status
+}
+
+func drop(sh *Shell, args []string) int {
+	return sh.DB.Drop(args[0])
+}
+
+func rename(sh *Shell, args []string) int {
+	return sh.DB.Rename(args[0], args[1])
+}
+
+// Changes the definition of a table while it is locked exclusively, in the current transaction or in a
+// new one committed afterwards (the data file may be rebuilt).
+func (sh *Shell) alter(name string, change func(t *table.Table) int) int {
+	t, status := sh.DB.Get(name)
+	if status != st.OK {
+		return status
+	}
+	tr := sh.Tr
+	own := tr == nil
+	if own {
+		tr = transaction.New(sh.DB)
+	}
+	status = tr.ELock(t)
+	if status == st.OK {
+		status = change(t)
+	}
+	if own {
+		if status == st.OK {
+			status = tr.Commit()
+		} else {
+			tr.Rollback()
+		}
+	}
+	return status
+}
+
+func add(sh *Shell, args []string) int {
+	length, err := strconv.Atoi(args[2])
+	if err != nil {
+		fmt.Println("Column length must be a number.")
+		return st.OK
+	}
+	columnType := column.String
+	if len(args) > 3 {
+		columnType = args[3]
+	}
+	return sh.alter(args[0], func(t *table.Table) int { return t.AddTyped(args[1], length, columnType) })
+}
+
+func remove(sh *Shell, args []string) int {
+	return sh.alter(args[0], func(t *table.Table) int { return t.Remove(args[1]) })
+}
+
+// Makes a table keep multiple versions of rows.
+func versions(sh *Shell, args []string) int {
+	return sh.alter(args[0], func(t *table.Table) int { return t.AddVersions() })
+}
+
+func begin(sh *Shell, args []string) int {
+	if sh.Tr != nil {
+		fmt.Println("A transaction is already in progress.")
+		return st.OK
+	}
+	sh.Tr = transaction.New(sh.DB)
+	return st.OK
+}
+
+func commit(sh *Shell, args []string) int {
+	if sh.Tr == nil {
+		fmt.Println("No transaction is in progress.")
+		return st.OK
+	}
+	status := sh.Tr.Commit()
+	sh.Tr = nil
+	return status
+}
+
+func rollback(sh *Shell, args []string) int {
+	if sh.Tr == nil {
+		fmt.Println("No transaction is in progress.")
+		return st.OK
+	}
+	status := sh.Tr.Rollback()
+	sh.Tr = nil
+	return status
+}
+
+func savepoint(sh *Shell, args []string) int {
+	if sh.Tr == nil {
+		fmt.Println("No transaction is in progress.")
+		return st.OK
+	}
+	return sh.Tr.Savepoint(args[0])
+}
+
+// Undoes changes made after the savepoint, the transaction goes on.
+func rollbackTo(sh *Shell, args []string) int {
+	if sh.Tr == nil {
+		fmt.Println("No transaction is in progress.")
+		return st.OK
+	}
+	return sh.Tr.RollbackTo(args[0])
+}
+
+func release(sh *Shell, args []string) int {
+	if sh.Tr == nil {
+		fmt.Println("No transaction is in progress.")
+		return st.OK
+	}
+	return sh.Tr.Release(args[0])
+}
+
+// Returns the table for changing its rows in the current transaction, which locks the changed rows.
+func (sh *Shell) writable(name string) (*table.Table, int) {
+	if sh.Tr == nil {
+		fmt.Println("Use begin to start a transaction first.")
+		return nil, st.OK
+	}
+	return sh.DB.Get(name)
+}
+
+// Returns the table for reading its rows, the table is locked for reading in the current transaction.
+func (sh *Shell) readable(name string) (*table.Table, int) {
+	t, status := sh.DB.Get(name)
+	if status != st.OK || sh.Tr == nil {
+		return t, status
+	}
+	return t, sh.Tr.ReadLock(t)
+}
+
+// Converts COLUMN=VALUE arguments into a row.
+func assignments(args []string) (map[string]string, bool) {
+	row := make(map[string]string)
+	for _, arg := range args {
+		equal := strings.Index(arg, "=")
+		if equal < 1 {
+			fmt.Println("Expected COLUMN=VALUE but found " + arg)
+			return nil, false
+		}
+		row[arg[:equal]] = arg[equal+1:]
+	}
+	return row, true
+}
+
+// Converts an argument into a row number.
+func rowNumber(arg string) (int, bool) {
+	number, err := strconv.Atoi(arg)
+	if err != nil || number < 0 {
+		fmt.Println("Row number must be a non-negative number.")
+		return 0, false
+	}
+	return number, true
+}
+
+func insertRow(sh *Shell, args []string) int {
+	t, status := sh.writable(args[0])
+	if t == nil || status != st.OK {
+		return status
+	}
+	row, ok := assignments(args[1:])
+	if !ok {
+		return st.OK
+	}
+	return sh.Tr.Insert(t, row)
+}
+
+func updateRow(sh *Shell, args []string) int {
+	t, status := sh.writable(args[0])
+	if t == nil || status != st.OK {
+		return status
+	}
+	number, ok := rowNumber(args[1])
+	if !ok {
+		return st.OK
+	}
+	row, ok := assignments(args[2:])
+	if !ok {
+		return st.OK
+	}
+	updated, status := sh.Tr.UpdateVersion(t, number, row)
+	if status == st.OK && updated != number {
+		fmt.Println("The updated row is row", updated)
+	}
+	return status
+}
+
+func deleteRow(sh *Shell, args []string) int {
+	t, status := sh.writable(args[0])
+	if t == nil || status != st.OK {
+		return status
+	}
+	number, ok := rowNumber(args[1])
+	if !ok {
+		return st.OK
+	}
+	return sh.Tr.Delete(t, number)
+}
@@ -0,0 +1,161 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/*
+dbgo - interactive shell of DBGo database.
+
+Usage: dbgo <database directory>
+
+Type "help" in the shell for a list of commands.
+*/
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"database"
+	"transaction"
+	"st"
+)
+
+// State of the interactive shell.
+type Shell struct {
+	DB *database.Database
+	Tr *transaction.Transaction // current explicit transaction, nil if there is none
+}
+
+// Splits a command line into words. Words may be quoted in single or double quotes.
+// Returns false if a quote is not closed.
+func words(line string) ([]string, bool) {
+	words := make([]string, 0)
+	var word string
+	var quote int
+	inWord := false
+	for _, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word += string(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word)
+				word = ""
+				inWord = false
+			}
+		default:
+			word += string(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, false
+	}
+	if inWord {
+		words = append(words, word)
+	}
+	return words, true
+}
+
+// Executes a command line, returns false if the shell should quit.
+func (sh *Shell) Execute(line string) bool {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return true
+	}
+	// Everything after "sql" is a SQL statement, and the RA pipeline is split by "|".
+	command, rest := line, ""
+	if space := strings.IndexAny(line, " \t"); space != -1 {
+		command, rest = line[:space], strings.TrimSpace(line[space+1:])
+	}
+	// Commit and rollback end the transaction, its error is reported afterwards.
+	tr := sh.Tr
+	switch strings.ToLower(command) {
+	case "quit", "exit":
+		return false
+	case "sql":
+		report(sh.SQL(rest), tr)
+		return true
+	case "query":
+		report(sh.Query(rest), tr)
+		return true
+	}
+	args, ok := words(line)
+	if !ok {
+		fmt.Println("Unterminated quote.")
+		return true
+	}
+	command = strings.ToLower(args[0])
+	handler, exists := commands[command]
+	if !exists {
+		fmt.Println("Unknown command " + args[0] + ", type help for a list of commands.")
+		return true
+	}
+	if len(args)-1 < handler.MinArgs {
+		fmt.Println("Usage: " + handler.Usage)
+		return true
+	}
+	report(handler.Run(sh, args[1:]), tr)
+	return true
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: dbgo <database directory>")
+		os.Exit(1)
+	}
+	path := os.Args[1]
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	db, status := database.Open(path)
+	if status != st.OK {
+		fmt.Fprintln(os.Stderr, "Cannot open database "+path+": "+db.Err().String())
+		os.Exit(1)
+	}
+	sh := &Shell{DB: db}
+	in := bufio.NewReader(os.Stdin)
+	for {
+		if sh.Tr == nil {
+			fmt.Print("dbgo> ")
+		} else {
+			fmt.Print("dbgo*> ")
+		}
+		line, err := in.ReadString('\n')
+		if line != "" && !sh.Execute(line) {
+			break
+		}
+		if err != nil {
+			fmt.Println()
+			break
+		}
+	}
+	// Uncommitted changes are not kept.
+	if sh.Tr != nil {
+		report(sh.Tr.Rollback(), sh.Tr)
+	}
+	db.Close()
+}
@@ -0,0 +1,65 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/* Printing rows as aligned tables. */
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Prints the header and rows as a table, each column is as wide as its widest value.
+func printTable(header []string, rows [][]string) {
+	widths := make([]int, len(header))
+	for i, name := range header {
+		widths[i] = len(name)
+	}
+	for _, row := range rows {
+		for i, value := range row {
+			if len(value) > widths[i] {
+				widths[i] = len(value)
+			}
+		}
+	}
+	separator := "+"
+	for _, width := range widths {
+		separator += strings.Repeat("-", width+2) + "+"
+	}
+	fmt.Println(separator)
+	printRow(widths, header)
+	fmt.Println(separator)
+	for _, row := range rows {
+		printRow(widths, row)
+	}
+	fmt.Println(separator)
+	if len(rows) == 1 {
+		fmt.Println("1 row")
+	} else {
+		fmt.Println(len(rows), "rows")
+	}
+}
+
+func printRow(widths []int, row []string) {
+	line := "|"
+	for i, value := range row {
+		line += " " + value + strings.Repeat(" ", widths[i]-len(value)) + " |"
+	}
+	fmt.Println(line)
+}
@@ -0,0 +1,234 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/* Running relational algebra queries and SQL statements in the shell. */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"constant"
+	"filter"
+	"ra"
+	"sql"
+	"table"
+	"st"
+)
+
+// Comparison filters usable in a query "select" operation.
+var queryFilters = map[string]filter.Filter{"=": filter.Eq{}, "!=": filter.Ne{}, "<": filter.Lt{},
+	"<=": filter.Le{}, ">": filter.Gt{}, ">=": filter.Ge{}, "like": filter.Like{}, "regex": filter.Regex{},
+	"prefix": filter.Prefix{}, "suffix": filter.Suffix{}}
+
+// Returns the names of user columns of a table, in the order they are defined.
+func userColumns(t *table.Table) []string {
+	names := make([]string, 0)
+	for _, c := range t.ColumnsInOrder {
+		if !strings.HasPrefix(c.Name, constant.ThePrefix) {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+// Appends names which are not already in the list.
+func appendNew(list []string, names []string) []string {
+	for _, name := range names {
+		exists := false
+		for _, existing := range list {
+			if existing == name {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			list = append(list, name)
+		}
+	}
+	return list
+}
+
+// Runs a relational algebra pipeline (operations separated by "|") and prints the result.
+func (sh *Shell) Query(pipeline string) int {
+	r := ra.New()
+	// Aliases in the RA result, in the order they are printed.
+	aliases := make([]string, 0)
+	for _, operation := range strings.Split(pipeline, "|") {
+		args, ok := words(operation)
+		if !ok || len(args) == 0 {
+			fmt.Println("Malformed query operation: " + strings.TrimSpace(operation))
+			return st.OK
+		}
+		var t *table.Table
+		var status int
+		var err os.Error
+		switch strings.ToLower(args[0]) {
+		case "load":
+			if len(args) != 2 {
+				fmt.Println("Usage: load TABLE")
+				return st.OK
+			}
+			t, status = sh.readable(args[1])
+			if status != st.OK {
+				return status
+			}
+			_, status = r.Load(t)
+			if status == st.OK {
+				// Deleted rows are left out before they are counted by limit and offset.
+				_, status = r.ExcludeDeleted()
+			}
+			aliases = appendNew(aliases, userColumns(t))
+		case "join", "hashjoin", "leftjoin", "rightjoin", "fulljoin":
+			if len(args) != 4 {
+				fmt.Println("Usage: " + args[0] + " ALIAS TABLE COLUMN")
+				return st.OK
+			}
+			if _, exists := r.Aliases[args[1]]; !exists {
+				return st.AliasNotFound
+			}
+			t, status = sh.readable(args[2])
+			if status != st.OK {
+				return status
+			}
+			switch strings.ToLower(args[0]) {
+			case "join":
+				_, status = r.NLJoin(args[1], t, args[3])
+			case "hashjoin":
+				_, status = r.HashJoin(args[1], t, args[3])
+			case "leftjoin":
+				_, status = r.LeftJoin(args[1], t, args[3])
+			case "rightjoin":
+				_, status = r.RightJoin(args[1], t, args[3])
+			case "fulljoin":
+				_, status = r.FullJoin(args[1], t, args[3])
+			}
+			if status == st.OK {
+				_, status = r.ExcludeDeleted()
+			}
+			aliases = appendNew(aliases, userColumns(t))
+		case "select":
+			if len(args) != 4 || queryFilters[args[2]] == nil {
+				fmt.Println("Usage: select ALIAS =|!=|<|<=|>|>=|like|regex|prefix|suffix VALUE")
+				return st.OK
+			}
+			if _, exists := r.Aliases[args[1]]; !exists {
+				return st.AliasNotFound
+			}
+			f := queryFilters[args[2]]
+			_, status = r.Select(args[1], f, args[3])
+		case "project":
+			if len(args) < 2 {
+				fmt.Println("Usage: project ALIAS...")
+				return st.OK
+			}
+			for _, alias := range args[1:] {
+				if _, exists := r.Aliases[alias]; !exists {
+					return st.AliasNotFound
+				}
+			}
+			_, status = r.Project(args[1:]...)
+			aliases = args[1:]
+		case "redefine":
+			if len(args) != 3 {
+				fmt.Println("Usage: redefine ALIAS NEW_ALIAS")
+				return st.OK
+			}
+			_, status = r.Redefine(args[1], args[2])
+			for i, alias := range aliases {
+				if alias == args[1] {
+					aliases[i] = args[2]
+				}
+			}
+		case "limit", "offset":
+			var n int
+			if len(args) == 2 {
+				n, err = strconv.Atoi(args[1])
+			}
+			if len(args) != 2 || err != nil {
+				fmt.Println("Usage: " + args[0] + " NUMBER")
+				return st.OK
+			}
+			if strings.ToLower(args[0]) == "limit" {
+				_, status = r.Limit(n)
+			} else {
+				_, status = r.Offset(n)
+			}
+		default:
+			fmt.Println("Unknown query operation " + args[0])
+			return st.OK
+		}
+		if status != st.OK {
+			return status
+		}
+	}
+	return printResult(r, aliases)
+}
+
+// Prints the columns of RA result.
+func printResult(r *ra.Result, aliases []string) int {
+	rows := make([][]string, 0)
+	for i := 0; i < r.NumberOfRows(); i++ {
+		row, status := r.ReadAliases(i)
+		if status != st.OK {
+			return status
+		}
+		line := make([]string, len(aliases))
+		for j, alias := range aliases {
+			value, exists := row[alias]
+			if !exists {
+				// The row is missing after an outer join.
+				value = "NULL"
+			}
+			line[j] = value
+		}
+		rows = append(rows, line)
+	}
+	printTable(aliases, rows)
+	return st.OK
+}
+
+// Runs a SQL statement in the current transaction, or in its own transaction if there is none.
+func (sh *Shell) SQL(text string) int {
+	parser := sql.NewParser(text)
+	statement, status := parser.Parse()
+	if status != st.OK {
+		if parser.Err() != nil {
+			fmt.Println(parser.Err())
+			return st.OK
+		}
+		return status
+	}
+	output, status := statement.Execute(sh.DB, sh.Tr)
+	if status != st.OK {
+		return status
+	}
+	if output.Result != nil {
+		if status = printResult(output.Result, output.Columns); status != st.OK {
+			return status
+		}
+		if output.Plan != "" {
+			fmt.Println(output.Plan)
+		}
+		return st.OK
+	}
+	fmt.Println(output.Affected, "rows affected")
+	return st.OK
+}
@@ -21,17 +21,17 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 	"database"
 	"transaction"
 	"constraint"
 	"ra"
 	"filter"
+	"snapshot"
 )
 
-const (
-	// must point to an EMPTY directory
-	DBPath = "/home/houzuo/temp/"
-)
+// Must point to an EMPTY directory, set by the first command line argument.
+var DBPath string
 
 // Cleans up created example database.
 func cleanUp() {
@@ -164,6 +164,10 @@ func Eg4() {
 	tr1 := transaction.New(db)
 	tr2 := transaction.New(db)
 
+	// Fail immediately instead of waiting for conflicting locks to be released.
+	tr1.LockTimeout = 0
+	tr2.LockTimeout = 0
+
 	// tr1 locks t1 exclusively.
 	fmt.Println("tr1 lock t1 exclusively", tr1.ELock(t1))
 
@@ -190,6 +194,18 @@ func Eg4() {
 	fmt.Println("tr2 rolls back", tr2.Rollback())
 	locks, status = transaction.LocksOf(t1)
 	fmt.Println("Existing locks on t1", locks, status)
+
+	// Transactions may lock different rows of a table exclusively at the same time.
+	fmt.Println("tr1 locks row 0 of t1 exclusively", tr1.ELockRow(t1, 0))
+	fmt.Println("tr2 locks row 1 of t1 exclusively", tr2.ELockRow(t1, 1))
+	fmt.Println("tr2 tries to lock row 0 of t1 in shared (error)", tr2.SLockRow(t1, 0))
+
+	// Table locks conflict with row locks of other transactions.
+	fmt.Println("tr2 tries to lock t1 in shared (error)", tr2.SLock(t1))
+	locks, status = transaction.LocksOf(t1)
+	fmt.Println("Existing locks on t1", locks, status)
+	fmt.Println("tr1 commits", tr1.Commit())
+	fmt.Println("tr2 commits", tr2.Commit())
 }
 
 // Transaction commit and rollback.
@@ -237,6 +253,20 @@ func Eg5() {
 	for _, row := range rows {
 		fmt.Println(row)
 	}
+
+	// Roll back only the changes made after a savepoint, the transaction goes on.
+	fmt.Println("Insert", tr.Insert(t1, map[string]string{"c1": "c", "c2": "222"}))
+	fmt.Println("Savepoint", tr.Savepoint("inserted"))
+	fmt.Println("Delete", tr.Delete(t1, 2))
+	fmt.Println("Roll back to savepoint", tr.RollbackTo("inserted"))
+	fmt.Println("Release savepoint", tr.Release("inserted"))
+	fmt.Println("Roll back to released savepoint (error)", tr.RollbackTo("inserted"))
+	fmt.Println("Commit", tr.Commit())
+	rows, status = t1.SelectAll()
+	fmt.Println("Select all rows", status)
+	for _, row := range rows {
+		fmt.Println(row)
+	}
 }
 
 // PK and FK constraints.
@@ -287,6 +317,8 @@ func Eg6() {
 
 	// Delete "Buzz" in PERSON will trigger delete-restricted and will return an error.
 	fmt.Println("Delete 1 (error)", tr.Delete(PERSON, 0))
+	// The error of the failed operation tells the table and row involved.
+	fmt.Println("Error", tr.Err())
 
 	// Delete "NikkiH" in PERSON will trigger delete-restricted but will not return an error.
 	fmt.Println("Delete 2", tr.Delete(PERSON, 1))
@@ -468,7 +500,63 @@ func Eg8() {
 	}
 }
 
+// Snapshot reads of multi-version tables.
+func Eg9() {
+	db, status := database.Open(DBPath)
+	fmt.Println("Open database", status)
+
+	// Make t1 keep multiple versions of rows (it gets ~creator and ~deleter columns).
+	t1, status := db.Create("t1")
+	fmt.Println("Create t1", status)
+	fmt.Println("Add c1", t1.Add("c1", 5))
+	fmt.Println("Add versions", t1.AddVersions())
+
+	tr := transaction.New(db)
+	fmt.Println("Insert", tr.Insert(t1, map[string]string{"c1": "a"}))
+	fmt.Println("Commit", tr.Commit())
+
+	// tr updates the row but does not commit yet.
+	fmt.Println("Update", tr.Update(t1, 0, map[string]string{"c1": "b"}))
+
+	// A snapshot sees committed rows only, reading it does not lock t1.
+	old := snapshot.Take(0)
+	printSnapshot := func(s *snapshot.Snapshot) {
+		query := ra.New()
+		query.Snapshot = s
+		query.Load(t1)
+		query.ExcludeDeleted()
+		for i := 0; i < query.NumberOfRows(); i++ {
+			row, _ := query.Read(i)
+			fmt.Println(row)
+		}
+	}
+	printSnapshot(old)
+
+	// After tr commits, the old snapshot still sees the old version, a new snapshot sees the new version.
+	fmt.Println("Commit", tr.Commit())
+	printSnapshot(old)
+	current := snapshot.Take(0)
+	printSnapshot(current)
+	current.Release()
+
+	// Once no snapshot is in use, rebuilding data file removes the old version.
+	old.Release()
+	fmt.Println("Lock t1 exclusively", tr.ELock(t1))
+	fmt.Println("Rebuild data file", t1.RebuildDataFile("", 0, ""))
+	fmt.Println("Commit", tr.Commit())
+	numberOfRows, status := t1.NumberOfRows()
+	fmt.Println("Number of rows", numberOfRows, status)
+}
+
 func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: examples <empty directory>")
+		os.Exit(1)
+	}
+	DBPath = os.Args[1]
+	if !strings.HasSuffix(DBPath, "/") {
+		DBPath += "/"
+	}
 	cleanUp()
 	fmt.Println("\n\n\t\tC:")
 	Eg1()
@@ -493,4 +581,7 @@ func main() {
 	cleanUp()
 	fmt.Println("\n\n\t\tC: C: C: C: C: C: C: C:")
 	Eg8()
+	cleanUp()
+	fmt.Println("\n\n\t\tC: C: C: C: C: C: C: C: C:")
+	Eg9()
 }
@@ -21,42 +21,188 @@ Conversions between text definition of a column and a Column.
 
 A column is defined in the following format in table's ".def" file:
 columnName1:maxLength1
-columnName2:maxLength2
-columnName3:maxLength3
+columnName2:maxLength2:type2
+columnName3:maxLength3:type3
+
+The type is optional, a column without type is a string column.
+Supported types are: string, text, int, float, bool, date (YYYY-MM-DD) and bytes.
+Values of bytes columns are stored in hexadecimal, thus a bytes column of length
+10 holds at most 5 bytes. Float values are finite numbers, NaN and infinities are not accepted.
+Values of text columns have variable length, values which do not fit in the column
+are stored in table's heap file and the column holds a pointer to the value.
 */
 
 package column
 
 import (
+	"os"
+	"math"
+	"time"
 	"strconv"
 	"strings"
+	"encoding/hex"
+	"constant"
 	"st"
 	"logg"
 )
 
+// Column types.
+const (
+	String = "string"
+	Text   = "text"
+	Int    = "int"
+	Float  = "float"
+	Bool   = "bool"
+	Date   = "date"
+	Bytes  = "bytes"
+)
+
 type Column struct {
 	Offset int // offset of the column in table row
 	Length int // max length of the column
 	Name   string
+	Type   string // type of the column values
+}
+
+// Returns true if the column type is supported.
+func ValidType(columnType string) bool {
+	switch columnType {
+	case String, Text, Int, Float, Bool, Date, Bytes:
+		return true
+	}
+	return false
 }
 
 // Constructs a Column from a column's text definition.
 func ColumnFromDef(offset int, definition string) (*Column, int) {
 	var column *Column
-	// Extract length and name from the definition.
+	// Extract length, name and (optional) type from the definition.
 	lengthName := strings.Split(definition, ":")
+	if len(lengthName) < 2 || len(lengthName) > 3 {
+		logg.Err("Column", "ColumnFromDef", "Definition malformed: "+definition)
+		return nil, st.InvalidColumnDefinition
+	}
 	length, err := strconv.Atoi(lengthName[1])
 	if err != nil {
 		logg.Err("Column", "ColumnFromDef", "Definition malformed: "+definition)
 		return nil, st.InvalidColumnDefinition
 	}
-	column = &Column{Offset: offset, Length: length, Name: lengthName[0]}
+	columnType := String
+	if len(lengthName) == 3 {
+		columnType = strings.TrimSpace(lengthName[2])
+		if !ValidType(columnType) {
+			logg.Err("Column", "ColumnFromDef", "Unknown column type: "+definition)
+			return nil, st.InvalidColumnType
+		}
+	}
+	column = &Column{Offset: offset, Length: length, Name: lengthName[0], Type: columnType}
 	return column, st.OK
 }
 
 // Constructs a text definition of a column.
 func ColumnToDef(column *Column) string {
-	return column.Name + ":" + strconv.Itoa(column.Length) + "\n"
+	// String columns are written without type, so that old definition files stay the same.
+	if column.Type == "" || column.Type == String {
+		return column.Name + ":" + strconv.Itoa(column.Length) + "\n"
+	}
+	return column.Name + ":" + strconv.Itoa(column.Length) + ":" + column.Type + "\n"
+}
+
+// Validates a value and converts it into the text which is stored in table data file.
+// An empty value is always accepted (the column has no value).
+func (column *Column) Encode(value string) (string, int) {
+	var encoded string
+	var err os.Error
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "" {
+		return "", st.OK
+	}
+	switch column.Type {
+	case Int:
+		var i int64
+		i, err = strconv.Atoi64(trimmed)
+		encoded = strconv.Itoa64(i)
+	case Float:
+		var f float64
+		f, err = strconv.Atof64(trimmed)
+		// NaN has no order, it cannot be compared (e.g. as an index key).
+		if err == nil && (math.IsNaN(f) || math.IsInf(f, 0)) {
+			err = os.NewError("not a finite number")
+		}
+		encoded = strconv.Ftoa64(f, 'g', -1)
+	case Bool:
+		var b bool
+		b, err = strconv.Atob(trimmed)
+		encoded = strconv.Btoa(b)
+	case Date:
+		var t *time.Time
+		t, err = time.Parse(constant.DateFormat, trimmed)
+		if err == nil {
+			encoded = t.Format(constant.DateFormat)
+		}
+	case Bytes:
+		encoded = hex.EncodeToString([]byte(value))
+	default:
+		// String and text values are stored as they are.
+		return value, st.OK
+	}
+	if err != nil {
+		logg.Err("column", "Encode", "Value "+value+" is not a valid "+column.Type+" for column "+column.Name)
+		return "", st.InvalidColumnValue
+	}
+	if len(encoded) > column.Length {
+		logg.Err("column", "Encode", "Value "+value+" is too long for column "+column.Name)
+		return "", st.ColumnValueTooLong
+	}
+	return encoded, st.OK
+}
+
+// Returns true if values of the column have variable length (stored in table's heap file if too long).
+func (column *Column) IsVariable() bool {
+	return column.Type == Text
+}
+
+// Converts the text stored in table data file back into the value given to Encode.
+func (column *Column) Decode(stored string) (string, int) {
+	if column.Type == Bytes && stored != "" {
+		decoded, err := hex.DecodeString(stored)
+		if err != nil {
+			logg.Err("column", "Decode", "Column "+column.Name+" has malformed bytes value "+stored)
+			return "", st.InvalidColumnValue
+		}
+		return string(decoded), st.OK
+	}
+	return stored, st.OK
+}
+
+// Converts the text stored in table data file into a typed value.
+// Returns int64, float64, bool, *time.Time, []byte or string according to column type,
+// or nil if the column has no value.
+func (column *Column) Value(stored string) (interface{}, int) {
+	var value interface{}
+	var err os.Error
+	if stored == "" {
+		return nil, st.OK
+	}
+	switch column.Type {
+	case Int:
+		value, err = strconv.Atoi64(stored)
+	case Float:
+		value, err = strconv.Atof64(stored)
+	case Bool:
+		value, err = strconv.Atob(stored)
+	case Date:
+		value, err = time.Parse(constant.DateFormat, stored)
+	case Bytes:
+		value, err = hex.DecodeString(stored)
+	default:
+		return stored, st.OK
+	}
+	if err != nil {
+		logg.Err("column", "Value", "Column "+column.Name+" has malformed "+column.Type+" value "+stored)
+		return nil, st.InvalidColumnValue
+	}
+	return value, st.OK
 }
 
 // <The Bible Code> is a very interesting book :)
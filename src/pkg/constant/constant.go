@@ -31,13 +31,30 @@ const (
 	MaxTriggerFuncNameLength  = 50
 	MaxTriggerParameterLength = 200
 	TriggerOperationLength    = 4
-	LockTimeout               = 60000000000 // (60 seconds) timeout of table locks (shared & exclusive) in nanoseconds
-	ExclusiveLockFilePerm     = 0666        // permission for opening .exclusive file of table lock
+	LockTimeout               = 60000000000  // (60 seconds) timeout of table locks (shared & exclusive) in nanoseconds
+	LockWaitTimeout           = 10000000000  // (10 seconds) default time a transaction waits for a table lock
+	LockPollInterval          = 10000000     // (10 milliseconds) interval of attempts to lock a table held by other processes
+	RegistryPollInterval      = 100000000    // (100 milliseconds) interval of looking for other processes opening the database
+	ExclusiveLockFilePerm     = 0666         // permission for opening .exclusive file of table lock
+	DateFormat                = "2006-01-02" // format of date column values
+	HeapFilePerm              = 0666         // permission for opening .heap file of table
+	HeapPointerPrefix         = "*"          // prefix of a pointer to value stored in .heap file
+	MinTextColumnLength       = 24           // text column must be long enough to hold a heap pointer
+	WALFilePerm               = 0666         // permission for opening .wal file of database
+	IndexFilePerm             = 0666         // permission for opening .idx file of column index
+	IndexFileExtension        = ".idx"       // extension name of column index files
+	IndexPageSize             = 4096         // size of a page in column index file
+	TemporaryDirPrefix        = "dbgo"       // prefix of directories holding temporary tables
+	AggregateColumnLength     = 32           // length of computed numeric aggregate columns
+	SortMemoryBudget          = 16777216     // (16 MB) memory used by sorting before it sorts in temporary files
+	SortFilePrefix            = "~sort"      // prefix of temporary files of external merge sort
+	SortMergeWidth            = 64           // number of sorted runs (temporary files) merged at a time
+	TransactionIDLength       = 20           // length of columns holding transaction IDs (~creator, ~deleter)
 )
 
 // Returns the extension names which table files have.
 func TableFiles() []string {
-	return []string{".data", ".def"}
+	return []string{".data", ".def", ".heap"}
 }
 
 // Returns the column names and lengths which a new table have. 
@@ -45,6 +62,11 @@ func DatabaseColumns() map[string]int {
 	return map[string]int{ThePrefix + "del": 1}
 }
 
+// Returns the column names and lengths which a multi-version table has in addition.
+func VersionColumns() map[string]int {
+	return map[string]int{ThePrefix + "creator": TransactionIDLength, ThePrefix + "deleter": TransactionIDLength}
+}
+
 // Returns the directory suffixes which table directories have. 
 func TableDirs() []string {
 	return []string{".shared"}
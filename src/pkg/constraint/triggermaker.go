@@ -16,7 +16,16 @@ You should have received a copy of the GNU General Public License
 along with this program.  If not, see <http://www.gnu.org/licenses/>.
 */
 
-/* Making/removing PK/FK constraints and triggers. */
+/*
+Making/removing PK/FK constraints and triggers.
+
+Making a constraint also creates indexes on the key columns (if they are not indexed yet),
+so that the constraint triggers do not have to read through tables.
+Removing a constraint leaves the indexes in place.
+The indexes are not unique: FK columns hold duplicated values, and uniqueness of PK values is checked
+by PK trigger, which compares values rather than index keys. Long text columns cannot be indexed,
+the triggers read through their tables.
+*/
 
 package constraint
 
@@ -28,12 +37,26 @@ import (
 	"filter"
 )
 
+// Creates an index on a column if the column is not indexed yet and can be indexed.
+func ensureIndex(t *table.Table, name string) int {
+	status := t.CreateIndex(name)
+	if status == st.IndexAlreadyExists || status == st.CannotIndexColumnType {
+		return st.OK
+	}
+	return status
+}
+
 // Makes a primary key constraint on a column.
 func PK(db *database.Database, t *table.Table, name string) int {
 	beforeTable, status := db.Get("~before")
 	if status != st.OK {
 		return status
 	}
+	// PK trigger looks for the new value in PK column.
+	status = ensureIndex(t, name)
+	if status != st.OK {
+		return status
+	}
 	// On PK table and PK column, triggers PK function before insert.
 	status = beforeTable.Insert(map[string]string{"TABLE": t.Name, "COLUMN": name, "FUNC": "PK", "OP": "IN"})
 	if status != st.OK {
@@ -57,6 +80,15 @@ func FK(db *database.Database, fkTable *table.Table, fkColumn string, pkTable *t
 	if status != st.OK {
 		return status
 	}
+	// FK trigger looks for the value in PK column, UR and DR triggers look for the value in FK column.
+	status = ensureIndex(pkTable, pkColumn)
+	if status != st.OK {
+		return status
+	}
+	status = ensureIndex(fkTable, fkColumn)
+	if status != st.OK {
+		return status
+	}
 	// On FK table and FK column, triggers FK function before insert.
 	status = beforeTable.Insert(map[string]string{"TABLE": fkTable.Name, "COLUMN": fkColumn, "FUNC": "FK", "OP": "IN", "PARAM": pkTable.Name + ";" + pkColumn})
 	if status != st.OK {
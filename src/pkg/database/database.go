@@ -22,26 +22,54 @@ Database logics.
 DBGo database is stored in a directory. DBGo data files do not use very special extension names,
 thus it is better to give a DBGo database an empty directory to begin with, and better not to 
 store any other user files in the directory.
+
+A Database is safe for concurrent use through its methods; ranging over Tables directly is only safe
+while no table is created, dropped or renamed.
+The error of the latest failed operation, naming the table involved and wrapping the OS error, is
+kept by the database (see Err).
 */
 
 package database
 
 import (
 	"os"
+	"sync"
 	"table"
 	"util"
 	"st"
 	"constant"
 	"logg"
 	"tablefilemanager"
+	"wal"
 )
 
 type Database struct {
-	Path   string // path to database directory, must end with slash /
-	Tables map[string]*table.Table
+	Path     string // path to database directory, must end with slash /
+	Tables   map[string]*table.Table
+	Log      *wal.Log  // write-ahead log
+	Registry *Registry // processes having the database open
+	mutex    sync.RWMutex
+	err      *st.Error // error of the latest failed operation
+	errMutex sync.Mutex
+}
+
+// Returns the error of the latest failed operation on the database, nil if no operation has failed.
+func (db *Database) Err() *st.Error {
+	db.errMutex.Lock()
+	defer db.errMutex.Unlock()
+	return db.err
+}
+
+// Remembers the error of a failed operation, returns its status code.
+func (db *Database) fail(e *st.Error) int {
+	db.errMutex.Lock()
+	defer db.errMutex.Unlock()
+	db.err = e
+	return e.Code
 }
 
 // Opens a path as database.
+// If opening fails, the returned database is only good for telling the error (see Err).
 func Open(path string) (*Database, int) {
 	var db *Database
 	db = new(Database)
@@ -49,16 +77,14 @@ func Open(path string) (*Database, int) {
 	// Open and read content of the path (as a directory).
 	directory, err := os.Open(path)
 	if err != nil {
-		db = nil
 		logg.Err("database", "Open", err.String())
-		return db, st.CannotOpenDatabaseDirectory
+		return db, db.fail(st.Wrap(st.CannotOpenDatabaseDirectory, err))
 	}
 	defer directory.Close()
 	fi, err := directory.Readdir(0)
 	if err != nil {
-		db = nil
 		logg.Err("database", "Open", err.String())
-		return db, st.CannotReadDatabaseDirectory
+		return db, db.fail(st.Wrap(st.CannotReadDatabaseDirectory, err))
 	}
 	for _, fileInfo := range fi {
 		// Extract extension of file name.
@@ -68,17 +94,41 @@ func Open(path string) (*Database, int) {
 			if ext == "data" {
 				_, exists := db.Tables[name]
 				if !exists {
-					var status int
 					// Open the table and put it into tables map.
-					db.Tables[name], status = table.Open(path, name)
+					t, status := table.Open(path, name)
 					if status != st.OK {
-						return nil, status
+						return db, db.fail(st.From(status, t.Err()).WithTable(name))
 					}
+					db.Tables[name] = t
 				}
 			}
 		}
 	}
 	db.Path = path
+	var status int
+	db.Log, status = wal.Open(path)
+	if status != st.OK {
+		return db, db.fail(st.New(status))
+	}
+	// Transactions of processes which leave the database without finishing them are undone.
+	registry, alone, status := openRegistry(path, func(pid int, host string) int {
+		db.mutex.RLock()
+		defer db.mutex.RUnlock()
+		return db.Log.RecoverProcess(pid, host, db.Tables)
+	})
+	if status != st.OK {
+		return db, db.fail(st.New(status))
+	}
+	db.Registry = registry
+	// Undo changes made by transactions which were interrupted by a crash.
+	// Transactions of other processes having the database open are still in progress.
+	if alone {
+		status = wal.Recover(path, db.Tables)
+		if status != st.OK {
+			return db, db.fail(st.New(status))
+		}
+	}
+	db.Log.Shared = func() bool { return registry.Shared() }
 	return db, db.PrepareForTriggers(false)
 }
 
@@ -97,10 +147,12 @@ func (db *Database) PrepareForTriggers(override bool) int {
 		}
 	}
 	// Create flag file .init.
-	_, err := os.OpenFile(db.Path+".init", os.O_CREATE, constant.InitFilePerm)
+	initFile, err := os.OpenFile(db.Path+".init", os.O_CREATE, constant.InitFilePerm)
 	if err != nil {
-		return st.CannotCreateInitFile
+		logg.Err("database", "PrepareForTriggers", err.String())
+		return db.fail(st.Wrap(st.CannotCreateInitFile, err))
 	}
+	initFile.Close()
 	// Create ~before ("before" triggers) and ~after ("after" triggers) tables.
 	beforeTable, status := db.Create("~before")
 	if status != st.OK {
@@ -115,7 +167,7 @@ func (db *Database) PrepareForTriggers(override bool) int {
 		for name, length := range constant.TriggerLookupTable() {
 			status = t.Add(name, length)
 			if status != st.OK {
-				return status
+				return db.fail(st.From(status, t.Err()))
 			}
 		}
 	}
@@ -124,76 +176,102 @@ func (db *Database) PrepareForTriggers(override bool) int {
 
 // Creates a new table.
 func (db *Database) Create(name string) (*table.Table, int) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
 	var newTable *table.Table
 	_, exists := db.Tables[name]
 	if exists {
-		return nil, st.TableAlreadyExists
+		return nil, db.fail(st.New(st.TableAlreadyExists).WithTable(name))
 	}
 	if len(name) > constant.MaxTableNameLength {
-		return nil, st.TableNameTooLong
+		return nil, db.fail(st.New(st.TableNameTooLong).WithTable(name))
 	}
 	// Create table files and directories.
-	tablefilemanager.Create(db.Path, name)
+	if e := tablefilemanager.Create(db.Path, name); e != nil {
+		return nil, db.fail(e)
+	}
 	// Open the table
 	var status int
 	newTable, status = table.Open(db.Path, name)
-	if status == st.OK {
-		// Add default columns
-		for columnName, length := range constant.DatabaseColumns() {
-			status = newTable.Add(columnName, length)
-			if status != st.OK {
-				return nil, status
-			}
+	if status != st.OK {
+		return nil, db.fail(st.From(status, newTable.Err()).WithTable(name))
+	}
+	// Add default columns
+	for columnName, length := range constant.DatabaseColumns() {
+		status = newTable.Add(columnName, length)
+		if status != st.OK {
+			return nil, db.fail(st.From(status, newTable.Err()))
 		}
-		db.Tables[name] = newTable
 	}
+	db.Tables[name] = newTable
 	return newTable, st.OK
 }
 
 // Drops a table.
 func (db *Database) Drop(name string) int {
-	_, exists := db.Tables[name]
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	t, exists := db.Tables[name]
 	if !exists {
-		return st.TableNotFound
+		return db.fail(st.New(st.TableNotFound).WithTable(name))
 	}
 	db.Tables[name] = nil, false
+	t.Close()
 	// Remove table files and directories.
-	return tablefilemanager.Delete(db.Path, name)
+	if e := tablefilemanager.Delete(db.Path, name); e != nil {
+		return db.fail(e)
+	}
+	return st.OK
 }
 
 // Renames a table
 func (db *Database) Rename(oldName, newName string) int {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
 	_, exists := db.Tables[oldName]
 	if !exists {
-		return st.TableNotFound
+		return db.fail(st.New(st.TableNotFound).WithTable(oldName))
 	}
 	_, exists = db.Tables[newName]
 	if exists {
-		return st.TableAlreadyExists
+		return db.fail(st.New(st.TableAlreadyExists).WithTable(newName))
 	}
 	db.Tables[oldName].Flush()
 	// Rename table files and directories
-	status := tablefilemanager.Rename(db.Path, oldName, newName)
-	if status != st.OK {
-		return status
+	if e := tablefilemanager.Rename(db.Path, oldName, newName); e != nil {
+		return db.fail(e)
 	}
-	db.Tables[newName], status = table.Open(db.Path, newName)
+	t, status := table.Open(db.Path, newName)
 	db.Tables[oldName] = nil, false
-	return status
+	if status != st.OK {
+		return db.fail(st.From(status, t.Err()).WithTable(newName))
+	}
+	db.Tables[newName] = t
+	return st.OK
 }
 
 // Returns a Table by name.
 func (db *Database) Get(name string) (*table.Table, int) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
 	var table *table.Table
 	table, exists := db.Tables[name]
 	if !exists {
-		return nil, st.TableNotFound
+		return nil, db.fail(st.New(st.TableNotFound).WithTable(name))
 	}
 	return table, st.OK
 }
 
+// Flushes all tables and leaves the process registry, the database should no longer be used.
+func (db *Database) Close() {
+	db.Flush()
+	db.Registry.Close()
+}
+
 // Flushes all tables.
 func (db *Database) Flush() {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
 	for _, t := range db.Tables {
 		t.Flush()
 	}
@@ -0,0 +1,293 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/*
+Registry of processes which have opened a database.
+
+Each process having the database open keeps a file in .processes directory of the database, named
+after its host and process ID:
+  PID HOST DEADLINE STATE
+The process renews DEADLINE while it runs, a process whose deadline has passed or which no longer
+runs on this host is no longer a member, its unfinished transactions are undone and its file is removed.
+STATE is "alone" while the process is the only member, its transactions then lock tables in memory
+only. It is "shared" while there are other members, table locks are then also recorded in lock files.
+A member notices a new member within RegistryPollInterval, calls the functions given to OnShare
+(which write in-memory locks to lock files) and then becomes "shared"; if a function fails, it stays
+"alone" and tries again on the next poll. A joining process waits until all other members are
+"shared" before it uses the database.
+Files are written to a temporary file (named with ThePrefix) and renamed. A file which cannot be parsed
+is a member in unknown state until LockTimeout after it was last modified.
+*/
+
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"constant"
+	"st"
+	"util"
+	"logg"
+)
+
+// Member states.
+const (
+	Alone  = "alone"
+	Shared = "shared"
+)
+
+type Registry struct {
+	Path     string // path to .processes directory, ends with slash /
+	name     string // name of the file of this process
+	shared   int32  // 1 if other processes may hold the database
+	deadline int64  // deadline of this process's membership
+	hooks    []func() int
+	mutex    sync.Mutex // protects hooks and the file of this process
+	stop     chan bool
+	// Undoes the unfinished transactions of a process which is no longer a member.
+	reaped func(pid int, host string) int
+}
+
+// Another process having the database open.
+type member struct {
+	pid      int
+	host     string
+	deadline int64
+	state    string
+}
+
+// Joins the registry of a database, reaped is called for each former member before its file is removed.
+// Returns true if no other process has the database open.
+func openRegistry(path string, reaped func(pid int, host string) int) (*Registry, bool, int) {
+	reg := &Registry{Path: path + ".processes/", stop: make(chan bool, 1),
+		name: util.Hostname() + "-" + strconv.Itoa(os.Getpid()), reaped: reaped}
+	err := os.MkdirAll(reg.Path, constant.TableDirPerm)
+	if err != nil {
+		logg.Err("database", "openRegistry", err.String())
+		return nil, false, st.CannotWriteRegistryFile
+	}
+	// Write own file before looking for other members, so that processes joining at the same
+	// time see each other.
+	status := reg.write(Alone)
+	if status != st.OK {
+		return nil, false, status
+	}
+	others, status := reg.members()
+	if status != st.OK {
+		return nil, false, status
+	}
+	alone := len(others) == 0
+	if !alone {
+		atomic.AddInt32(&reg.shared, 1)
+		status = reg.write(Shared)
+		if status != st.OK {
+			return nil, false, status
+		}
+		status = reg.waitForShared()
+		if status != st.OK {
+			reg.Close()
+			return nil, false, status
+		}
+	}
+	go reg.watch()
+	return reg, alone, st.OK
+}
+
+// Returns true if other processes may hold the database, then table locks must be in lock files.
+func (reg *Registry) Shared() bool {
+	return reg == nil || atomic.AddInt32(&reg.shared, 0) == 1
+}
+
+// Adds a function to be called when another process opens the database.
+func (reg *Registry) OnShare(hook func() int) {
+	if reg == nil {
+		return
+	}
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	reg.hooks = append(reg.hooks, hook)
+}
+
+// Leaves the registry.
+func (reg *Registry) Close() {
+	reg.stop <- true
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	os.Remove(reg.Path + reg.name)
+}
+
+// Writes the file of this process with a new deadline.
+func (reg *Registry) write(state string) int {
+	reg.deadline = time.Nanoseconds() + constant.LockTimeout
+	content := strconv.Itoa(os.Getpid()) + " " + util.Hostname() + " " + strconv.Itoa64(reg.deadline) + " " + state
+	return util.WriteAndRename(reg.Path+reg.name, content)
+}
+
+// Returns the other members by their file names, files of former members are removed.
+func (reg *Registry) members() (map[string]*member, int) {
+	files, err := ioutil.ReadDir(reg.Path)
+	if err != nil {
+		logg.Err("database", "members", err.String())
+		return nil, st.CannotReadRegistryDir
+	}
+	others := make(map[string]*member)
+	for _, fileInfo := range files {
+		if fileInfo.Name == reg.name || strings.Contains(fileInfo.Name, constant.ThePrefix) {
+			continue
+		}
+		content, err := ioutil.ReadFile(reg.Path + fileInfo.Name)
+		if err != nil {
+			// The member has left.
+			continue
+		}
+		m, parsed := parseMember(string(content))
+		if !parsed {
+			logg.Warn("database", "members", "Cannot parse registry file "+fileInfo.Name)
+			m = &member{deadline: fileInfo.Mtime_ns + constant.LockTimeout}
+		}
+		if time.Nanoseconds() > m.deadline || util.Hostname() != "" && m.host == util.Hostname() && !util.Alive(m.pid) {
+			logg.Warn("database", "members", "Process "+fileInfo.Name+" no longer has the database open")
+			if m.pid != 0 && reg.reaped != nil {
+				status := reg.reaped(m.pid, m.host)
+				if status != st.OK {
+					// The process remains a member until its transactions are undone.
+					logg.Err("database", "members", "Cannot undo transactions of process "+fileInfo.Name+": "+st.New(status).String())
+					others[fileInfo.Name] = m
+					continue
+				}
+			}
+			os.Remove(reg.Path + fileInfo.Name)
+			continue
+		}
+		others[fileInfo.Name] = m
+	}
+	return others, st.OK
+}
+
+// Parses the content of a member's file, returns false if the content is malformed.
+func parseMember(content string) (*member, bool) {
+	fields := strings.Fields(content)
+	if len(fields) != 4 {
+		return nil, false
+	}
+	m := &member{host: fields[1], state: fields[3]}
+	var err1, err2 os.Error
+	m.pid, err1 = strconv.Atoi(fields[0])
+	m.deadline, err2 = strconv.Atoi64(fields[2])
+	return m, err1 == nil && err2 == nil
+}
+
+// Waits until all other members are in shared state.
+func (reg *Registry) waitForShared() int {
+	deadline := time.Nanoseconds() + constant.LockTimeout
+	for {
+		others, status := reg.members()
+		if status != st.OK {
+			return status
+		}
+		ready := true
+		for _, m := range others {
+			if m.state != Shared {
+				ready = false
+			}
+		}
+		if ready {
+			return st.OK
+		}
+		if time.Nanoseconds() > deadline {
+			return st.DatabaseBusy
+		}
+		time.Sleep(constant.RegistryPollInterval)
+	}
+	return st.OK
+}
+
+// Keeps the membership of this process and follows the other members.
+func (reg *Registry) watch() {
+	for {
+		select {
+		case <-reg.stop:
+			return
+		case <-time.After(constant.RegistryPollInterval):
+		}
+		status := reg.refresh()
+		if status != st.OK {
+			logg.Err("database", "watch", "Cannot refresh process registry "+reg.Path+": "+st.New(status).String())
+		}
+	}
+}
+
+// Renews the membership, switches between alone and shared state as other processes come and go.
+func (reg *Registry) refresh() int {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	others, status := reg.members()
+	if status != st.OK {
+		return status
+	}
+	if len(others) > 0 && !reg.Shared() {
+		// Locks must be in lock files before the new member is told to go ahead.
+		atomic.AddInt32(&reg.shared, 1)
+		hooks := reg.hooks
+		reg.mutex.Unlock()
+		for _, hook := range hooks {
+			status = hook()
+			if status != st.OK {
+				break
+			}
+		}
+		reg.mutex.Lock()
+		if status != st.OK {
+			// The new member keeps waiting, sharing is tried again on the next poll.
+			logg.Err("database", "refresh", "Cannot share the database: "+st.New(status).String())
+			atomic.AddInt32(&reg.shared, -1)
+			return status
+		}
+		return reg.write(Shared)
+	}
+	if len(others) == 0 && reg.Shared() {
+		// Announce the state before looking again, a process joining meanwhile either sees
+		// this process shared, or waits for it to become shared again.
+		status = reg.write(Alone)
+		if status != st.OK {
+			return status
+		}
+		others, status = reg.members()
+		if status != st.OK {
+			return status
+		}
+		if len(others) > 0 {
+			return reg.write(Shared)
+		}
+		atomic.AddInt32(&reg.shared, -1)
+		return st.OK
+	}
+	// Renew the membership when half of it has passed.
+	if time.Nanoseconds() > reg.deadline-constant.LockTimeout/2 {
+		if reg.Shared() {
+			return reg.write(Shared)
+		}
+		return reg.write(Alone)
+	}
+	return st.OK
+}
@@ -22,6 +22,7 @@ package filter
 
 import (
 	"strconv"
+	"strings"
 	"fmt"
 )
 
@@ -29,45 +30,171 @@ type Filter interface {
 	Cmp(v1, v2 interface{}) bool
 }
 
-type Eq struct {
+// How comparison and text filters compare values.
+type Mode int
+
+const (
+	Default Mode = iota // the filter's default mode, Eq, Ne and text filters compare text, the others numbers
+	Numeric             // values are converted to double, the filter is false if a value is not a number
+	Text                // values are compared as strings
+	Auto                // numeric if both values are numbers, otherwise text
+)
+
+// Returns the mode which is used if the mode is Default.
+func (mode Mode) Or(defaultMode Mode) Mode {
+	if mode == Default {
+		return defaultMode
+	}
+	return mode
+}
+
+// Compares two values in the mode, returns -1, 0 or 1.
+// The second return value is false if the values cannot be compared in the mode.
+func Compare(mode Mode, v1, v2 interface{}) (int, bool) {
+	s1, s2 := fmt.Sprint(v1), fmt.Sprint(v2)
+	if mode == Numeric || mode == Auto {
+		d1, err1 := strconv.Atof64(strings.TrimSpace(s1))
+		d2, err2 := strconv.Atof64(strings.TrimSpace(s2))
+		if err1 == nil && err2 == nil {
+			switch {
+			case d1 < d2:
+				return -1, true
+			case d1 > d2:
+				return 1, true
+			}
+			return 0, true
+		}
+		if mode == Numeric {
+			return 0, false
+		}
+	}
+	switch {
+	case s1 < s2:
+		return -1, true
+	case s1 > s2:
+		return 1, true
+	}
+	return 0, true
+}
+
+// Returns the values of a parameter which holds a list (e.g. []string{"a", "b"}, []int{1, 2}),
+// a parameter which is not a list is a list of one value.
+func List(parameter interface{}) []interface{} {
+	switch values := parameter.(type) {
+	case []interface{}:
+		return values
+	case []string:
+		list := make([]interface{}, len(values))
+		for i, value := range values {
+			list[i] = value
+		}
+		return list
+	case []int:
+		list := make([]interface{}, len(values))
+		for i, value := range values {
+			list[i] = value
+		}
+		return list
+	case []float64:
+		list := make([]interface{}, len(values))
+		for i, value := range values {
+			list[i] = value
+		}
+		return list
+	}
+	return []interface{}{parameter}
+}
 
+type Eq struct {
+	Mode Mode
 }
 
-// Tests if two strings are equal.
+// Tests if two values are equal, compared as strings by default.
 func (f Eq) Cmp(v1, v2 interface{}) bool {
-	return fmt.Sprint(v1) == fmt.Sprint(v2)
+	result, ok := Compare(f.Mode.Or(Text), v1, v2)
+	return ok && result == 0
 }
 
-type Lt struct {
+type Ne struct {
+	Mode Mode
+}
 
+// Tests if two values are not equal, compared as strings by default.
+// Always returns false if the values cannot be compared in the mode.
+func (f Ne) Cmp(v1, v2 interface{}) bool {
+	result, ok := Compare(f.Mode.Or(Text), v1, v2)
+	return ok && result != 0
 }
-// Tests if value 1 is less than value2. The values are converted to double before comparison. 
-// Always returns false if number format is unexpected.
+
+type Lt struct {
+	Mode Mode
+}
+
+// Tests if value 1 is less than value2. The values are converted to double before comparison by default.
+// Always returns false if the values cannot be compared in the mode (e.g. number format is unexpected).
 func (f Lt) Cmp(v1, v2 interface{}) bool {
-	d1, err := strconv.Atof64(fmt.Sprint(v1))
-	if err != nil {
-		return false
-	}
-	d2, err := strconv.Atof64(fmt.Sprint(v2))
-	if err != nil {
-		return false
-	}
-	return d1 < d2
+	result, ok := Compare(f.Mode.Or(Numeric), v1, v2)
+	return ok && result < 0
 }
 
-type Gt struct {
+type Le struct {
+	Mode Mode
+}
 
+// Tests if value 1 is less than or equal to value2, compared as numbers by default.
+func (f Le) Cmp(v1, v2 interface{}) bool {
+	result, ok := Compare(f.Mode.Or(Numeric), v1, v2)
+	return ok && result <= 0
 }
-// Tests if value 1 is greater than value2. The values are converted to double before comparison. 
-// Always returns false if number format is unexpected.
+
+type Gt struct {
+	Mode Mode
+}
+
+// Tests if value 1 is greater than value2. The values are converted to double before comparison by default.
+// Always returns false if the values cannot be compared in the mode (e.g. number format is unexpected).
 func (f Gt) Cmp(v1, v2 interface{}) bool {
-	d1, err := strconv.Atof64(fmt.Sprint(v1))
-	if err != nil {
+	result, ok := Compare(f.Mode.Or(Numeric), v1, v2)
+	return ok && result > 0
+}
+
+type Ge struct {
+	Mode Mode
+}
+
+// Tests if value 1 is greater than or equal to value2, compared as numbers by default.
+func (f Ge) Cmp(v1, v2 interface{}) bool {
+	result, ok := Compare(f.Mode.Or(Numeric), v1, v2)
+	return ok && result >= 0
+}
+
+type Between struct {
+	Mode Mode
+}
+
+// Tests if value 1 is between the two values of value 2 (e.g. []int{1, 10}), bounds included.
+// The values are compared as numbers by default. Always returns false if value 2 does not have two values.
+func (f Between) Cmp(v1, v2 interface{}) bool {
+	bounds := List(v2)
+	if len(bounds) != 2 {
 		return false
 	}
-	d2, err := strconv.Atof64(fmt.Sprint(v2))
-	if err != nil {
-		return false
+	low, lowOK := Compare(f.Mode.Or(Numeric), v1, bounds[0])
+	high, highOK := Compare(f.Mode.Or(Numeric), v1, bounds[1])
+	return lowOK && highOK && low >= 0 && high <= 0
+}
+
+type In struct {
+	Mode Mode
+}
+
+// Tests if value 1 equals any value of value 2 (e.g. []string{"a", "b"}), compared as strings by default.
+func (f In) Cmp(v1, v2 interface{}) bool {
+	for _, value := range List(v2) {
+		result, ok := Compare(f.Mode.Or(Text), v1, value)
+		if ok && result == 0 {
+			return true
+		}
 	}
-	return d1 > d2
+	return false
 }
@@ -0,0 +1,206 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/*
+Filters which match text. Patterns (value 2) are always text, value 1 is matched according to the mode:
+in Text mode (the default) it is matched as it is; in Numeric mode it must be a number and is matched as
+the number written plainly (e.g. 1.50 and 01.5 as 1.5), otherwise the filter is false; in Auto mode a
+number is matched written plainly, other values as they are.
+*/
+
+package filter
+
+import (
+	"container/list"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"logg"
+)
+
+// Returns the text which value 1 is matched as in the mode (Default is Text).
+// The second return value is false if the value is not a number in Numeric mode.
+func matchedText(mode Mode, v interface{}) (string, bool) {
+	s := fmt.Sprint(v)
+	if mode == Numeric || mode == Auto {
+		d, err := strconv.Atof64(strings.TrimSpace(s))
+		if err == nil {
+			return strconv.Ftoa64(d, 'f', -1), true
+		}
+		return s, mode == Auto
+	}
+	return s, true
+}
+
+type Like struct {
+	IgnoreCase bool
+	Mode       Mode
+}
+
+// Tests if value 1 matches SQL LIKE pattern value 2, in which % matches any sequence of characters,
+// _ matches any one character and \ escapes the next character.
+func (f Like) Cmp(v1, v2 interface{}) bool {
+	value, ok := matchedText(f.Mode, v1)
+	if !ok {
+		return false
+	}
+	pattern := fmt.Sprint(v2)
+	if f.IgnoreCase {
+		value, pattern = strings.ToLower(value), strings.ToLower(pattern)
+	}
+	return like([]int(value), likePattern([]int(pattern)))
+}
+
+// Wildcards in a parsed LIKE pattern, characters are never negative.
+const (
+	anySequence = -1 // %
+	anyOne      = -2 // _
+)
+
+// Parses a LIKE pattern into characters and wildcards, escaped characters are never wildcards.
+func likePattern(pattern []int) []int {
+	parsed := make([]int, 0, len(pattern))
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == '%':
+			parsed = append(parsed, anySequence)
+		case pattern[i] == '_':
+			parsed = append(parsed, anyOne)
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			i++
+			parsed = append(parsed, pattern[i])
+		default:
+			parsed = append(parsed, pattern[i])
+		}
+	}
+	return parsed
+}
+
+// Matches characters of a value with a parsed LIKE pattern.
+// On a mismatch, the last % seen takes one more character and matching resumes after it (earlier %
+// never need to take more), thus matching takes at most len(value) * len(pattern) steps.
+func like(value, pattern []int) bool {
+	v, p := 0, 0
+	lastSequence, sequenceEnd := -1, 0 // position of the last % in pattern, and of its match's end in value
+	for v < len(value) {
+		switch {
+		case p < len(pattern) && pattern[p] == anySequence:
+			lastSequence, sequenceEnd = p, v
+			p++
+		case p < len(pattern) && (pattern[p] == anyOne || pattern[p] == value[v]):
+			v, p = v+1, p+1
+		case lastSequence != -1:
+			sequenceEnd++
+			v, p = sequenceEnd, lastSequence+1
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == anySequence {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// Compiled regular expressions, so that a pattern is compiled only once. The least recently used
+// regular expression is dropped when there are more than RegexCacheSize.
+var RegexCacheSize = 64
+var compiled = make(map[string]*list.Element) // pattern -> element of compiledOrder
+var compiledOrder = list.New()                // *compiledRegex, most recently used first
+var compiledMutex sync.Mutex
+
+type compiledRegex struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+// Returns the compiled regular expression of a pattern, nil if the pattern is invalid.
+func compile(pattern string) *regexp.Regexp {
+	compiledMutex.Lock()
+	defer compiledMutex.Unlock()
+	if element, exists := compiled[pattern]; exists {
+		compiledOrder.MoveToFront(element)
+		return element.Value.(*compiledRegex).re
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		logg.Warn("filter", "Regex", err.String())
+		return nil
+	}
+	compiled[pattern] = compiledOrder.PushFront(&compiledRegex{pattern, re})
+	for compiledOrder.Len() > RegexCacheSize {
+		oldest := compiledOrder.Back()
+		compiled[oldest.Value.(*compiledRegex).pattern] = nil, false
+		compiledOrder.Remove(oldest)
+	}
+	return re
+}
+
+type Regex struct {
+	Mode Mode
+}
+
+// Tests if value 1 matches regular expression value 2 (a pattern string or *regexp.Regexp).
+// Always returns false if the pattern is invalid.
+func (f Regex) Cmp(v1, v2 interface{}) bool {
+	value, ok := matchedText(f.Mode, v1)
+	if !ok {
+		return false
+	}
+	re, isRegexp := v2.(*regexp.Regexp)
+	if !isRegexp {
+		re = compile(fmt.Sprint(v2))
+		if re == nil {
+			return false
+		}
+	}
+	return re.MatchString(value)
+}
+
+type IsEmpty struct {
+	Mode Mode
+}
+
+// Tests if value 1 is empty or only has spaces, value 2 is not used.
+// In Numeric mode, a value which is not a number is empty as well.
+func (f IsEmpty) Cmp(v1, v2 interface{}) bool {
+	value, ok := matchedText(f.Mode, v1)
+	return !ok || strings.TrimSpace(value) == ""
+}
+
+type Prefix struct {
+	Mode Mode
+}
+
+// Tests if value 1 begins with value 2.
+func (f Prefix) Cmp(v1, v2 interface{}) bool {
+	value, ok := matchedText(f.Mode, v1)
+	return ok && strings.HasPrefix(value, fmt.Sprint(v2))
+}
+
+type Suffix struct {
+	Mode Mode
+}
+
+// Tests if value 1 ends with value 2.
+func (f Suffix) Cmp(v1, v2 interface{}) bool {
+	value, ok := matchedText(f.Mode, v1)
+	return ok && strings.HasSuffix(value, fmt.Sprint(v2))
+}
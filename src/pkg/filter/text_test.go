@@ -0,0 +1,105 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package filter
+
+import (
+	"strings"
+	"testing"
+)
+
+var textTests = []struct {
+	filter Filter
+	v1, v2 interface{}
+	result bool
+}{
+	{Like{}, "BUZZ", "B%", true},
+	{Like{}, "BUZZ", "%Z", true},
+	{Like{}, "BUZZ", "%U%", true},
+	{Like{}, "BUZZ", "B_ZZ", true},
+	{Like{}, "BUZZ", "B_Z", false},
+	{Like{}, "BUZZ", "b%", false},
+	{Like{IgnoreCase: true}, "BUZZ", "b%", true},
+	{Like{}, "", "%", true},
+	{Like{}, "", "_", false},
+	{Like{}, "abcabd", "%abd", true},
+	{Like{}, "aaa", "%a%a%a%a", false},
+	// Escaped wildcards match themselves only, a trailing \ is a character.
+	{Like{}, "50%", `50\%`, true},
+	{Like{}, "500", `50\%`, false},
+	{Like{}, "A_B", `A\_B`, true},
+	{Like{}, "AXB", `A\_B`, false},
+	{Like{}, `A\`, `A\`, true},
+	{Like{}, "1.50", "1.5", false},
+	{Like{Mode: Numeric}, "01.50", "1.5", true},
+	{Like{Mode: Numeric}, " 1.50", "1.5%", true},
+	{Like{Mode: Numeric}, "abc", "%", false},
+	{Like{Mode: Auto}, "abc", "a%", true},
+	{Like{Mode: Auto}, "2.0", "2", true},
+	{Regex{}, "BUZZ", "^B.Z+$", true},
+	{Regex{}, "BUZZ", "^Z", false},
+	{Regex{}, "BUZZ", "[", false}, // invalid pattern
+	{Regex{Mode: Numeric}, "2.0", "^2$", true},
+	{Regex{Mode: Numeric}, "two", ".*", false},
+	{Prefix{}, "BUZZ", "BU", true},
+	{Prefix{}, "BUZZ", "UZ", false},
+	{Prefix{Mode: Numeric}, "007", "7", true},
+	{Suffix{}, "BUZZ", "ZZ", true},
+	{Suffix{}, "10.50", "5", false},
+	{Suffix{Mode: Numeric}, "10.50", "5", true},
+	{IsEmpty{}, "  ", nil, true},
+	{IsEmpty{}, "a", nil, false},
+	{IsEmpty{Mode: Numeric}, "a", nil, true},
+	{IsEmpty{Mode: Numeric}, "0", nil, false},
+}
+
+func TestText(t *testing.T) {
+	for _, test := range textTests {
+		if result := test.filter.Cmp(test.v1, test.v2); result != test.result {
+			t.Errorf("%T%v.Cmp(%v, %v) = %v, want %v", test.filter, test.filter, test.v1, test.v2, result, test.result)
+		}
+	}
+}
+
+// Patterns having many % must not take exponential time.
+func TestLikeManySequences(t *testing.T) {
+	value := strings.Repeat("a", 10000)
+	if (Like{}).Cmp(value, strings.Repeat("%a", 100)+"b") {
+		t.Error("pattern ending with b matches value of a's")
+	}
+	if !(Like{}).Cmp(value, strings.Repeat("%a", 100)) {
+		t.Error("pattern of %a does not match value of a's")
+	}
+}
+
+// The least recently used regular expressions are dropped.
+func TestRegexCache(t *testing.T) {
+	defer func(size int) { RegexCacheSize = size }(RegexCacheSize)
+	RegexCacheSize = 2
+	for _, pattern := range []string{"^a", "^b", "^a", "^c"} {
+		(Regex{}).Cmp("a", pattern)
+	}
+	if compiledOrder.Len() != 2 || len(compiled) != 2 {
+		t.Fatalf("%d regular expressions are cached, want 2", compiledOrder.Len())
+	}
+	for pattern, cached := range map[string]bool{"^a": true, "^b": false, "^c": true} {
+		if _, exists := compiled[pattern]; exists != cached {
+			t.Errorf("%s is cached: %v, want %v", pattern, exists, cached)
+		}
+	}
+}
@@ -0,0 +1,517 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/*
+Persistent B+ tree index of a table column.
+
+An index file is made of fixed size pages. Page 0 is the header, the other pages are tree nodes.
+Each entry in the tree is a column value (key) and the number of the row having the value,
+entries are ordered by key then row number, thus a key may appear in many entries.
+
+Leaf nodes are linked from left to right for range lookups. Deleting an entry removes it from
+its leaf but never merges nodes, the index is re-created when table data file is rebuilt.
+
+An Index is safe for concurrent use: lookups share a lock, changes hold it exclusively.
+The error of the latest failed operation, wrapping the OS error, is kept by the index (see Err).
+*/
+
+package index
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"strconv"
+	"encoding/binary"
+	"column"
+	"constant"
+	"st"
+	"logg"
+)
+
+const (
+	magic      = "DBGOIDX1"
+	headerSize = 8 + 8 + 8 + 4 + 4 + 1 + 16 // magic, root, pages, page size, key length, type length, type
+	nodeHeader = 1 + 2 + 8                  // leaf flag, number of entries, next leaf
+)
+
+type Index struct {
+	Path      string
+	File      *os.File
+	KeyLength int    // max length of keys
+	Type      string // type of the indexed column, decides order of keys
+	pageSize  int
+	capacity  int   // max number of entries in a node
+	root      int64 // page number of root node
+	pages     int64 // number of pages in the file
+	mutex     sync.RWMutex
+	err       *st.Error // error of the latest failed operation
+	errMutex  sync.Mutex
+}
+
+// Boundary of a range lookup.
+type Bound struct {
+	Key       string
+	Inclusive bool
+}
+
+// An entry in a tree node.
+type entry struct {
+	key string
+	row int64
+}
+
+// A tree node.
+type node struct {
+	number   int64 // page number
+	leaf     bool
+	next     int64 // page number of the next leaf, 0 if this is the last leaf
+	entries  []entry
+	children []int64 // page numbers of child nodes (len(entries)+1 of them), only for internal node
+}
+
+// Size of an entry in page.
+func slotSize(keyLength int) int {
+	return 2 + keyLength + 8
+}
+
+// Calculates page size and node capacity.
+func (index *Index) layout() {
+	slot := slotSize(index.KeyLength)
+	index.pageSize = constant.IndexPageSize
+	// A node must be able to hold at least 4 entries.
+	if minimum := nodeHeader + 8 + 4*(slot+8); index.pageSize < minimum {
+		index.pageSize = minimum
+	}
+	index.capacity = (index.pageSize - nodeHeader - 8) / (slot + 8)
+}
+
+// Returns the error of the latest failed operation on the index, nil if no operation has failed.
+func (index *Index) Err() *st.Error {
+	index.errMutex.Lock()
+	defer index.errMutex.Unlock()
+	return index.err
+}
+
+// Remembers the error of a failed operation, returns its status code.
+func (index *Index) fail(e *st.Error) int {
+	index.errMutex.Lock()
+	defer index.errMutex.Unlock()
+	index.err = e
+	return e.Code
+}
+
+// Creates a new empty index file.
+// If creating fails, the returned index is only good for telling the error (see Err).
+func Create(path string, keyLength int, columnType string) (*Index, int) {
+	var err os.Error
+	index := &Index{Path: path, KeyLength: keyLength, Type: columnType, root: 1, pages: 2}
+	index.layout()
+	index.File, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, constant.IndexFilePerm)
+	if err != nil {
+		logg.Err("index", "Create", err.String())
+		return index, index.fail(st.Wrap(st.CannotCreateIndexFile, err))
+	}
+	status := index.writeHeader()
+	if status != st.OK {
+		return index, status
+	}
+	// Root of an empty tree is an empty leaf.
+	status = index.writeNode(&node{number: 1, leaf: true, entries: make([]entry, 0)})
+	if status != st.OK {
+		return index, status
+	}
+	return index, st.OK
+}
+
+// Opens an existing index file.
+// If opening fails, the returned index is only good for telling the error (see Err).
+func Open(path string) (*Index, int) {
+	var err os.Error
+	index := &Index{Path: path}
+	index.File, err = os.OpenFile(path, os.O_RDWR, constant.IndexFilePerm)
+	if err != nil {
+		logg.Err("index", "Open", err.String())
+		return index, index.fail(st.Wrap(st.CannotOpenIndexFile, err))
+	}
+	header := make([]byte, headerSize)
+	_, err = index.File.ReadAt(header, 0)
+	if err != nil {
+		logg.Err("index", "Open", err.String())
+		return index, index.fail(st.Wrap(st.CannotReadIndexFile, err))
+	}
+	if string(header[0:8]) != magic {
+		logg.Err("index", "Open", path+" is not an index file")
+		return index, index.fail(st.Wrap(st.InvalidIndexFile, os.NewError(path+" is not an index file")))
+	}
+	index.root = int64(binary.BigEndian.Uint64(header[8:16]))
+	index.pages = int64(binary.BigEndian.Uint64(header[16:24]))
+	index.KeyLength = int(binary.BigEndian.Uint32(header[28:32]))
+	index.Type = string(header[33 : 33+int(header[32])])
+	index.layout()
+	if index.pageSize != int(binary.BigEndian.Uint32(header[24:28])) {
+		logg.Err("index", "Open", path+" has unexpected page size")
+		return index, index.fail(st.Wrap(st.InvalidIndexFile, os.NewError(path+" has unexpected page size")))
+	}
+	return index, st.OK
+}
+
+// Flushes the index file.
+func (index *Index) Flush() int {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	err := index.File.Sync()
+	if err != nil {
+		logg.Err("index", "Flush", err.String())
+		return index.fail(st.Wrap(st.CannotWriteIndexFile, err))
+	}
+	return st.OK
+}
+
+// Closes the index file.
+func (index *Index) Close() int {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	err := index.File.Close()
+	if err != nil {
+		logg.Err("index", "Close", err.String())
+		return index.fail(st.Wrap(st.CannotWriteIndexFile, err))
+	}
+	return st.OK
+}
+
+// Writes the header page.
+func (index *Index) writeHeader() int {
+	header := make([]byte, headerSize)
+	copy(header[0:8], magic)
+	binary.BigEndian.PutUint64(header[8:16], uint64(index.root))
+	binary.BigEndian.PutUint64(header[16:24], uint64(index.pages))
+	binary.BigEndian.PutUint32(header[24:28], uint32(index.pageSize))
+	binary.BigEndian.PutUint32(header[28:32], uint32(index.KeyLength))
+	header[32] = byte(len(index.Type))
+	copy(header[33:], index.Type)
+	_, err := index.File.WriteAt(header, 0)
+	if err != nil {
+		logg.Err("index", "writeHeader", err.String())
+		return index.fail(st.Wrap(st.CannotWriteIndexFile, err))
+	}
+	return st.OK
+}
+
+// Reads a node from its page.
+func (index *Index) readNode(number int64) (*node, int) {
+	page := make([]byte, index.pageSize)
+	_, err := index.File.ReadAt(page, number*int64(index.pageSize))
+	if err != nil {
+		logg.Err("index", "readNode", err.String())
+		return nil, index.fail(st.Wrap(st.CannotReadIndexFile, err))
+	}
+	n := &node{number: number, leaf: page[0] == 1}
+	count := int(binary.BigEndian.Uint16(page[1:3]))
+	n.next = int64(binary.BigEndian.Uint64(page[3:11]))
+	n.entries = make([]entry, count)
+	offset := nodeHeader
+	for i := 0; i < count; i++ {
+		keyLength := int(binary.BigEndian.Uint16(page[offset : offset+2]))
+		n.entries[i].key = string(page[offset+2 : offset+2+keyLength])
+		n.entries[i].row = int64(binary.BigEndian.Uint64(page[offset+2+index.KeyLength:]))
+		offset += slotSize(index.KeyLength)
+	}
+	if !n.leaf {
+		n.children = make([]int64, count+1)
+		offset = nodeHeader + index.capacity*slotSize(index.KeyLength)
+		for i := 0; i <= count; i++ {
+			n.children[i] = int64(binary.BigEndian.Uint64(page[offset:]))
+			offset += 8
+		}
+	}
+	return n, st.OK
+}
+
+// Writes a node into its page.
+func (index *Index) writeNode(n *node) int {
+	page := make([]byte, index.pageSize)
+	if n.leaf {
+		page[0] = 1
+	}
+	binary.BigEndian.PutUint16(page[1:3], uint16(len(n.entries)))
+	binary.BigEndian.PutUint64(page[3:11], uint64(n.next))
+	offset := nodeHeader
+	for _, e := range n.entries {
+		binary.BigEndian.PutUint16(page[offset:offset+2], uint16(len(e.key)))
+		copy(page[offset+2:offset+2+index.KeyLength], e.key)
+		binary.BigEndian.PutUint64(page[offset+2+index.KeyLength:], uint64(e.row))
+		offset += slotSize(index.KeyLength)
+	}
+	if !n.leaf {
+		offset = nodeHeader + index.capacity*slotSize(index.KeyLength)
+		for _, child := range n.children {
+			binary.BigEndian.PutUint64(page[offset:], uint64(child))
+			offset += 8
+		}
+	}
+	_, err := index.File.WriteAt(page, n.number*int64(index.pageSize))
+	if err != nil {
+		logg.Err("index", "writeNode", err.String())
+		return index.fail(st.Wrap(st.CannotWriteIndexFile, err))
+	}
+	return st.OK
+}
+
+// Allocates a new page at the end of index file.
+func (index *Index) allocate() (int64, int) {
+	number := index.pages
+	index.pages++
+	return number, index.writeHeader()
+}
+
+// Compares two keys according to column type, returns -1, 0 or 1.
+// Empty key (no value) is less than any other key.
+func (index *Index) compareKeys(k1, k2 string) int {
+	if k1 == k2 {
+		return 0
+	}
+	if k1 == "" {
+		return -1
+	}
+	if k2 == "" {
+		return 1
+	}
+	switch index.Type {
+	case column.Int:
+		i1, err1 := strconv.Atoi64(k1)
+		i2, err2 := strconv.Atoi64(k2)
+		if err1 == nil && err2 == nil && i1 != i2 {
+			if i1 < i2 {
+				return -1
+			}
+			return 1
+		}
+	case column.Float:
+		f1, err1 := strconv.Atof64(k1)
+		f2, err2 := strconv.Atof64(k2)
+		if err1 == nil && err2 == nil && f1 != f2 {
+			if f1 < f2 {
+				return -1
+			}
+			return 1
+		}
+	}
+	if k1 < k2 {
+		return -1
+	}
+	return 1
+}
+
+// Compares two entries by key then row number.
+func (index *Index) compare(e1, e2 entry) int {
+	if c := index.compareKeys(e1.key, e2.key); c != 0 {
+		return c
+	}
+	if e1.row < e2.row {
+		return -1
+	} else if e1.row > e2.row {
+		return 1
+	}
+	return 0
+}
+
+// Returns the position of the first entry in node which is greater than the entry.
+// For internal node, it is also the position of the child to descend into.
+func (index *Index) position(n *node, e entry) int {
+	return sort.Search(len(n.entries), func(i int) bool {
+		return index.compare(e, n.entries[i]) < 0
+	})
+}
+
+// Puts a key and row number into the index.
+func (index *Index) Insert(key string, row int) int {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	if len(key) > index.KeyLength {
+		return index.fail(st.New(st.IndexKeyTooLong))
+	}
+	separator, right, status := index.insert(index.root, entry{key, int64(row)})
+	if status != st.OK || separator == nil {
+		return status
+	}
+	// Root has split, the tree grows by one level.
+	number, status := index.allocate()
+	if status != st.OK {
+		return status
+	}
+	newRoot := &node{number: number, entries: []entry{*separator}, children: []int64{index.root, right}}
+	status = index.writeNode(newRoot)
+	if status != st.OK {
+		return status
+	}
+	index.root = number
+	return index.writeHeader()
+}
+
+// Inserts an entry into the subtree, returns the separator and page number of the new
+// right sibling if the node splits.
+func (index *Index) insert(number int64, e entry) (*entry, int64, int) {
+	n, status := index.readNode(number)
+	if status != st.OK {
+		return nil, 0, status
+	}
+	i := index.position(n, e)
+	if n.leaf {
+		n.entries = append(n.entries, entry{})
+		copy(n.entries[i+1:], n.entries[i:])
+		n.entries[i] = e
+	} else {
+		separator, right, status := index.insert(n.children[i], e)
+		if status != st.OK {
+			return nil, 0, status
+		}
+		if separator == nil {
+			return nil, 0, st.OK
+		}
+		// Child has split, put the separator and new child in this node.
+		n.entries = append(n.entries, entry{})
+		copy(n.entries[i+1:], n.entries[i:])
+		n.entries[i] = *separator
+		n.children = append(n.children, 0)
+		copy(n.children[i+2:], n.children[i+1:])
+		n.children[i+1] = right
+	}
+	if len(n.entries) <= index.capacity {
+		return nil, 0, index.writeNode(n)
+	}
+	return index.split(n)
+}
+
+// Splits an overflowing node into two, returns the separator and page number of the right node.
+func (index *Index) split(n *node) (*entry, int64, int) {
+	number, status := index.allocate()
+	if status != st.OK {
+		return nil, 0, status
+	}
+	middle := len(n.entries) / 2
+	right := &node{number: number, leaf: n.leaf}
+	var separator entry
+	if n.leaf {
+		// Leaf keeps all entries, separator is a copy of the first entry of right node.
+		right.entries = append([]entry{}, n.entries[middle:]...)
+		n.entries = n.entries[:middle]
+		separator = right.entries[0]
+		right.next = n.next
+		n.next = right.number
+	} else {
+		// Separator moves up from internal node.
+		separator = n.entries[middle]
+		right.entries = append([]entry{}, n.entries[middle+1:]...)
+		right.children = append([]int64{}, n.children[middle+1:]...)
+		n.entries = n.entries[:middle]
+		n.children = n.children[:middle+1]
+	}
+	status = index.writeNode(right)
+	if status != st.OK {
+		return nil, 0, status
+	}
+	status = index.writeNode(n)
+	if status != st.OK {
+		return nil, 0, status
+	}
+	return &separator, right.number, st.OK
+}
+
+// Removes a key and row number from the index.
+func (index *Index) Delete(key string, row int) int {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	e := entry{key, int64(row)}
+	n, status := index.readNode(index.root)
+	if status != st.OK {
+		return status
+	}
+	for !n.leaf {
+		n, status = index.readNode(n.children[index.position(n, e)])
+		if status != st.OK {
+			return status
+		}
+	}
+	for i, existing := range n.entries {
+		if index.compare(e, existing) == 0 {
+			n.entries = append(n.entries[:i], n.entries[i+1:]...)
+			return index.writeNode(n)
+		}
+	}
+	return st.OK
+}
+
+// Returns row numbers of the key.
+func (index *Index) Lookup(key string) ([]int, int) {
+	bound := &Bound{key, true}
+	return index.Range(bound, bound)
+}
+
+// Returns row numbers of keys between low and high bounds, ordered by key then row number.
+// A nil bound means unbounded.
+func (index *Index) Range(low, high *Bound) ([]int, int) {
+	index.mutex.RLock()
+	defer index.mutex.RUnlock()
+	rows := make([]int, 0)
+	// Descend to the leftmost leaf which may contain the low bound.
+	start := entry{row: -1}
+	if low != nil {
+		start.key = low.Key
+	}
+	n, status := index.readNode(index.root)
+	if status != st.OK {
+		return nil, status
+	}
+	for !n.leaf {
+		child := n.children[0]
+		if low != nil {
+			child = n.children[index.position(n, start)]
+		}
+		n, status = index.readNode(child)
+		if status != st.OK {
+			return nil, status
+		}
+	}
+	// Scan leaves from left to right.
+	for {
+		for _, e := range n.entries {
+			if low != nil {
+				c := index.compareKeys(e.key, low.Key)
+				if c < 0 || c == 0 && !low.Inclusive {
+					continue
+				}
+			}
+			if high != nil {
+				c := index.compareKeys(e.key, high.Key)
+				if c > 0 || c == 0 && !high.Inclusive {
+					return rows, st.OK
+				}
+			}
+			rows = append(rows[:], int(e.row))
+		}
+		if n.next == 0 {
+			break
+		}
+		n, status = index.readNode(n.next)
+		if status != st.OK {
+			return nil, status
+		}
+	}
+	return rows, st.OK
+}
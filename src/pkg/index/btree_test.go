@@ -0,0 +1,149 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package index
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+	"column"
+	"constant"
+	"st"
+)
+
+// Number of rows in the test index, row i has key i. Rows from numberOfKeys on have key "5".
+const (
+	numberOfKeys       = 500
+	numberOfDuplicates = 10
+)
+
+// Creates an index of an int column in a new temporary directory. Keys are long, thus nodes hold
+// few entries and the tree has several levels.
+func newIndex(t *testing.T) (string, *Index) {
+	dir, err := ioutil.TempDir("", constant.TemporaryDirPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, status := Create(dir+"/test"+constant.IndexFileExtension, 200, column.Int)
+	if status != st.OK {
+		t.Fatal(idx.Err())
+	}
+	// Insert out of order.
+	for i := 0; i < numberOfKeys; i++ {
+		row := i * 7 % numberOfKeys
+		if status = idx.Insert(strconv.Itoa(row), row); status != st.OK {
+			t.Fatal(idx.Err())
+		}
+	}
+	for i := 0; i < numberOfDuplicates; i++ {
+		if status = idx.Insert("5", numberOfKeys+i); status != st.OK {
+			t.Fatal(idx.Err())
+		}
+	}
+	return dir, idx
+}
+
+// Returns row numbers from first to last.
+func rowsBetween(first, last int) []int {
+	rows := make([]int, 0)
+	for i := first; i <= last; i++ {
+		rows = append(rows, i)
+	}
+	return rows
+}
+
+var rangeTests = []struct {
+	low, high *Bound
+	rows      []int
+}{
+	{&Bound{"10", true}, &Bound{"13", true}, []int{10, 11, 12, 13}},
+	{&Bound{"10", false}, &Bound{"13", false}, []int{11, 12}},
+	{&Bound{"5", true}, &Bound{"5", true}, append([]int{5}, rowsBetween(numberOfKeys, numberOfKeys+numberOfDuplicates-1)...)},
+	{&Bound{"99", true}, &Bound{"100", true}, []int{99, 100}}, // compared as numbers, not text
+	{nil, &Bound{"3", false}, []int{0, 1, 2}},
+	{&Bound{"497", true}, nil, []int{497, 498, 499}},
+	{&Bound{"-1", true}, &Bound{"-1", true}, []int{}},
+	{&Bound{"13", true}, &Bound{"10", true}, []int{}},
+	{&Bound{"1000", true}, nil, []int{}},
+}
+
+// Checks range lookups of an index.
+func checkRanges(t *testing.T, when string, idx *Index) {
+	for _, test := range rangeTests {
+		rows, status := idx.Range(test.low, test.high)
+		if status != st.OK {
+			t.Errorf("%s: Range(%v, %v) returned %s", when, test.low, test.high, idx.Err())
+			continue
+		}
+		if fmt.Sprint(rows) != fmt.Sprint(test.rows) {
+			t.Errorf("%s: Range(%v, %v) = %v, want %v", when, test.low, test.high, rows, test.rows)
+		}
+	}
+	all, _ := idx.Range(nil, nil)
+	if len(all) != numberOfKeys+numberOfDuplicates {
+		t.Errorf("%s: index has %d entries, want %d", when, len(all), numberOfKeys+numberOfDuplicates)
+	}
+}
+
+func TestRange(t *testing.T) {
+	dir, idx := newIndex(t)
+	defer os.RemoveAll(dir)
+	checkRanges(t, "after insert", idx)
+	// The tree is read back from the file.
+	if status := idx.Flush(); status != st.OK {
+		t.Fatal(idx.Err())
+	}
+	idx.Close()
+	idx, status := Open(idx.Path)
+	if status != st.OK {
+		t.Fatal(idx.Err())
+	}
+	defer idx.Close()
+	checkRanges(t, "after reopen", idx)
+}
+
+var deleteTests = []struct {
+	key  string
+	row  int
+	rows []int // rows of the key after deleting
+}{
+	{"10", 10, []int{}},
+	{"5", numberOfKeys + 3, []int{5, 500, 501, 502, 504, 505, 506, 507, 508, 509}},
+	{"5", 5, []int{500, 501, 502, 504, 505, 506, 507, 508, 509}},
+	{"11", 12, []int{11}}, // the row does not have the key
+	{"10", 10, []int{}},   // already deleted
+}
+
+func TestDelete(t *testing.T) {
+	dir, idx := newIndex(t)
+	defer os.RemoveAll(dir)
+	defer idx.Close()
+	for _, test := range deleteTests {
+		if status := idx.Delete(test.key, test.row); status != st.OK {
+			t.Errorf("Delete(%s, %d) returned %s", test.key, test.row, idx.Err())
+			continue
+		}
+		rows, _ := idx.Lookup(test.key)
+		if fmt.Sprint(rows) != fmt.Sprint(test.rows) {
+			t.Errorf("after Delete(%s, %d), Lookup(%s) = %v, want %v", test.key, test.row, test.key, rows, test.rows)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/*
+Explaining query plans.
+Explain executes a plan and describes each node on a line, indented under its parent:
+  Project PERSON.NAME  (estimated 10 rows, actual 8 rows, 0 reads, 0.012 ms)
+    Join SITE on PERSON.SITE = SITE.ID  (estimated 10 rows, actual 8 rows, 8 reads, 0.402 ms, nested loops, index on SITE.ID)
+      Scan PERSON where PERSON.AGE Gt 30  (estimated 30 rows, actual 8 rows, 100 reads, 1.310 ms, all rows)
+Reads (number of rows read from tables by the node's RA result, see ra.Result.Reads) and time of a
+node exclude its inputs. Concurrent queries on the same tables do not change the figures.
+*/
+
+package plan
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"ra"
+	"st"
+)
+
+// Executes a plan, returns its RA result and the description of the plan with figures of the execution.
+func Explain(root Node) (*ra.Result, string, int) {
+	r, status := root.Execute()
+	if status != st.OK {
+		return nil, "", status
+	}
+	return r, Describe(root), st.OK
+}
+
+// Describes a plan, a node on each line with its estimated rows and figures of its last execution.
+func Describe(root Node) string {
+	lines := make([]string, 0)
+	describe(root, 0, &lines)
+	return strings.Join(lines, "\n")
+}
+
+// Appends the description of a node and its inputs to the lines.
+func describe(node Node, depth int, lines *[]string) {
+	figures := []string{"estimated " + strconv.Itoa(int(Estimate(node)+0.5)) + " rows"}
+	stats := node.Stats()
+	if stats.Executed {
+		reads, nanoseconds := stats.Reads, stats.Nanoseconds
+		for _, child := range node.Children() {
+			if childStats := child.Stats(); childStats.Executed {
+				reads -= childStats.Reads
+				nanoseconds -= childStats.Nanoseconds
+			}
+		}
+		figures = append(figures, "actual "+strconv.Itoa(stats.Rows)+" rows", strconv.Itoa(reads)+" reads",
+			strconv.Ftoa64(float64(nanoseconds)/1e6, 'f', 3)+" ms")
+		if stats.Strategy != "" {
+			figures = append(figures, stats.Strategy)
+		}
+	}
+	*lines = append(*lines, strings.Repeat("  ", depth)+node.Describe()+"  ("+strings.Join(figures, ", ")+")")
+	for _, child := range node.Children() {
+		describe(child, depth+1, lines)
+	}
+}
+
+// Returns a predicate as text, e.g. "(PERSON.NAME Eq "x" OR PERSON.AGE Gt 30)".
+func describePredicate(p ra.Predicate) string {
+	switch p := p.(type) {
+	case ra.And:
+		return "(" + describePredicates(p, " AND ") + ")"
+	case ra.Or:
+		return "(" + describePredicates(p, " OR ") + ")"
+	case ra.Not:
+		return "NOT " + describePredicate(p.Predicate)
+	case ra.Cmp:
+		return p.Alias + " " + filterName(p.Filter) + " " + fmt.Sprintf("%#v", p.Parameter)
+	case ra.CmpAlias:
+		return p.Alias + " " + filterName(p.Filter) + " " + p.Other
+	}
+	return fmt.Sprint(p)
+}
+
+// Returns predicates as text, joined by the separator.
+func describePredicates(predicates []ra.Predicate, separator string) string {
+	described := make([]string, len(predicates))
+	for i, predicate := range predicates {
+		described[i] = describePredicate(predicate)
+	}
+	return strings.Join(described, separator)
+}
+
+// Returns the type name of a filter without package name, e.g. "Eq".
+func filterName(f interface{}) string {
+	name := fmt.Sprintf("%T", f)
+	return name[strings.LastIndex(name, ".")+1:]
+}
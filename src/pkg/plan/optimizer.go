@@ -0,0 +1,448 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/*
+Query optimizer.
+The optimizer rewrites a plan of inner joins, selects and a project into an equivalent plan which
+reads fewer rows:
+- Predicates of one table are pushed down into the table's scan, predicates of several tables are
+  evaluated right after the last of their tables is joined.
+- Aliases which are not used by later joins, predicates or the final project are removed after
+  each join.
+- Tables are joined starting from the one with the fewest estimated rows, then the smallest table
+  which has a join condition with the joined tables.
+- Nested loops join is used when the other table's column is indexed and the joined rows are few,
+  otherwise hash join.
+Equality between columns of two tables (ra.CmpAlias using filter.Eq) is a join condition.
+Plans having outer joins are not rewritten.
+*/
+
+package plan
+
+import (
+	"strings"
+	"constant"
+	"filter"
+	"ra"
+	"table"
+	"st"
+)
+
+// Estimated fraction of rows passing comparisons.
+const (
+	equalSelectivity   = 0.1
+	rangeSelectivity   = 0.3
+	patternSelectivity = 0.25
+	defaultSelectivity = 0.5
+)
+
+// Simple statistics of a table used by the optimizer.
+type Statistics struct {
+	Rows    int             // number of rows, including deleted rows
+	Indexed map[string]bool // indexed columns
+}
+
+// Returns statistics of a table.
+func StatisticsOf(t *table.Table) (*Statistics, int) {
+	rows, status := t.NumberOfRows()
+	if status != st.OK {
+		return nil, status
+	}
+	indexed := make(map[string]bool)
+	for name, _ := range t.Columns {
+		if t.Index(name) != nil {
+			indexed[name] = true
+		}
+	}
+	return &Statistics{rows, indexed}, st.OK
+}
+
+// Returns the estimated fraction of rows passing a predicate.
+func selectivity(p ra.Predicate) float64 {
+	switch p := p.(type) {
+	case ra.And:
+		fraction := 1.0
+		for _, predicate := range p {
+			fraction *= selectivity(predicate)
+		}
+		return fraction
+	case ra.Or:
+		fraction := 0.0
+		for _, predicate := range p {
+			fraction += selectivity(predicate)
+		}
+		if fraction > 1 {
+			return 1
+		}
+		return fraction
+	case ra.Not:
+		return 1 - selectivity(p.Predicate)
+	case ra.Cmp:
+		switch p.Filter.(type) {
+		case filter.Eq:
+			return equalSelectivity
+		case filter.In:
+			return min(1, equalSelectivity*float64(len(filter.List(p.Parameter))))
+		case filter.Ne:
+			return 1 - equalSelectivity
+		case filter.Lt, filter.Le, filter.Gt, filter.Ge, filter.Between:
+			return rangeSelectivity
+		case filter.Like, filter.Regex, filter.Prefix, filter.Suffix:
+			return patternSelectivity
+		}
+	}
+	return defaultSelectivity
+}
+
+func min(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Returns the parts of a predicate which must all be true.
+func conjuncts(p ra.Predicate) []ra.Predicate {
+	if p == nil {
+		return []ra.Predicate{}
+	}
+	if and, isAnd := p.(ra.And); isAnd {
+		parts := make([]ra.Predicate, 0)
+		for _, predicate := range and {
+			parts = append(parts, conjuncts(predicate)...)
+		}
+		return parts
+	}
+	return []ra.Predicate{p}
+}
+
+// Returns a predicate which is true if all of the predicates are true, nil if there is none.
+func all(predicates []ra.Predicate) ra.Predicate {
+	switch len(predicates) {
+	case 0:
+		return nil
+	case 1:
+		return predicates[0]
+	}
+	return ra.And(predicates)
+}
+
+// An equality join condition between an alias of one table and a column of another.
+type edge struct {
+	left, right string // qualified aliases
+}
+
+// A plan broken into its parts.
+type parts struct {
+	scans      []*Scan
+	edges      []edge
+	predicates []ra.Predicate
+}
+
+// Breaks a tree of inner joins, selects and scans into parts. Returns false if the tree has other nodes.
+func (p *parts) add(node Node) bool {
+	switch node := node.(type) {
+	case *Scan:
+		p.scans = append(p.scans, &Scan{Table: node.Table})
+		p.predicates = append(p.predicates, conjuncts(node.Predicate)...)
+	case *Select:
+		p.predicates = append(p.predicates, conjuncts(node.Predicate)...)
+		return p.add(node.Input)
+	case *Join:
+		if node.Kind != ra.Inner || !p.add(node.Input) || !p.add(node.Right) {
+			return false
+		}
+		p.edges = append(p.edges, edge{node.Alias, node.Right.Table.Name + "." + node.Column})
+	default:
+		return false
+	}
+	return true
+}
+
+// Returns the name of the table which a qualified alias belongs to.
+func tableOf(alias string, tables map[string]*table.Table) (string, int) {
+	dot := strings.Index(alias, ".")
+	if dot == -1 {
+		return "", st.AliasNotFound
+	}
+	t, exists := tables[alias[:dot]]
+	if !exists {
+		return "", st.AliasNotFound
+	}
+	if _, exists := t.Columns[alias[dot+1:]]; !exists {
+		return "", st.AliasNotFound
+	}
+	return t.Name, st.OK
+}
+
+// Returns the names of tables used by a predicate.
+func tablesOf(p ra.Predicate, tables map[string]*table.Table) (map[string]bool, int) {
+	used := make(map[string]bool)
+	for _, alias := range p.Aliases() {
+		name, status := tableOf(alias, tables)
+		if status != st.OK {
+			return nil, status
+		}
+		used[name] = true
+	}
+	return used, st.OK
+}
+
+// Returns the join condition of a predicate comparing columns of two tables for equality.
+func edgeOf(p ra.Predicate, tables map[string]*table.Table) (edge, bool) {
+	cmp, isCmp := p.(ra.CmpAlias)
+	if !isCmp {
+		return edge{}, false
+	}
+	// Joins compare values as they are, which is the same as comparing text.
+	eq, isEq := cmp.Filter.(filter.Eq)
+	if !isEq || eq.Mode.Or(filter.Text) != filter.Text {
+		return edge{}, false
+	}
+	left, leftStatus := tableOf(cmp.Alias, tables)
+	right, rightStatus := tableOf(cmp.Other, tables)
+	if leftStatus != st.OK || rightStatus != st.OK || left == right {
+		return edge{}, false
+	}
+	return edge{cmp.Alias, cmp.Other}, true
+}
+
+// Returns true if all of the tables are joined.
+func subset(tables, joined map[string]bool) bool {
+	for name, _ := range tables {
+		if !joined[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns qualified aliases of user columns of a table.
+func aliasesOf(t *table.Table) []string {
+	aliases := make([]string, 0)
+	for _, c := range t.ColumnsInOrder {
+		if !strings.HasPrefix(c.Name, constant.ThePrefix) {
+			aliases = append(aliases, t.Name+"."+c.Name)
+		}
+	}
+	return aliases
+}
+
+// Rewrites a plan so that it reads fewer rows, the rewritten plan gives the same RA result.
+func Optimize(root Node) (Node, int) {
+	// The final project is kept on top, the tree under it is rewritten.
+	var project *Project
+	tree := root
+	if p, isProject := root.(*Project); isProject {
+		project, tree = p, p.Input
+	}
+	p := &parts{make([]*Scan, 0), make([]edge, 0), make([]ra.Predicate, 0)}
+	if !p.add(tree) {
+		return root, st.OK
+	}
+	tables := make(map[string]*table.Table)
+	estimates := make(map[string]float64)
+	scans := make(map[string]*Scan)
+	for _, scan := range p.scans {
+		if _, exists := tables[scan.Table.Name]; exists {
+			return nil, st.TableAlreadyExists
+		}
+		tables[scan.Table.Name] = scan.Table
+		scans[scan.Table.Name] = scan
+	}
+	// Push predicates of one table down into its scan, turn column equalities into join conditions.
+	edges := p.edges
+	remaining := make([]ra.Predicate, 0)
+	pushed := make(map[string][]ra.Predicate)
+	for _, predicate := range p.predicates {
+		used, status := tablesOf(predicate, tables)
+		if status != st.OK {
+			return nil, status
+		}
+		if e, isEdge := edgeOf(predicate, tables); isEdge {
+			edges = append(edges, e)
+		} else if len(used) == 1 {
+			for name, _ := range used {
+				pushed[name] = append(pushed[name], predicate)
+			}
+		} else {
+			remaining = append(remaining, predicate)
+		}
+	}
+	for name, scan := range scans {
+		scan.Predicate = all(pushed[name])
+		stats, status := StatisticsOf(scan.Table)
+		if status != st.OK {
+			return nil, status
+		}
+		estimates[name] = float64(stats.Rows)
+		if scan.Predicate != nil {
+			estimates[name] *= selectivity(scan.Predicate)
+		}
+	}
+	// Begin with the table having the fewest estimated rows.
+	var first string
+	for name, _ := range tables {
+		if first == "" || estimates[name] < estimates[first] || estimates[name] == estimates[first] && name < first {
+			first = name
+		}
+	}
+	joined := map[string]bool{first: true}
+	var node Node = scans[first]
+	estimate := estimates[first]
+	node = prune(node, joined, tables, edges, remaining, project)
+	for len(joined) < len(tables) {
+		// Join the smallest table which has a join condition with the joined tables.
+		next, nextEdge := "", -1
+		for i, e := range edges {
+			left, _ := tableOf(e.left, tables)
+			right, _ := tableOf(e.right, tables)
+			if joined[right] && !joined[left] {
+				left, right = right, left
+				e = edge{e.right, e.left}
+				edges[i] = e
+			}
+			if joined[left] && !joined[right] && (next == "" || estimates[right] < estimates[next]) {
+				next, nextEdge = right, i
+			}
+		}
+		if next == "" {
+			return nil, st.MissingJoinCondition
+		}
+		e := edges[nextEdge]
+		edges = append(edges[:nextEdge], edges[nextEdge+1:]...)
+		join := &Join{Input: node, Right: scans[next], Alias: e.left, Column: e.right[len(next)+1:], Kind: ra.Inner}
+		join.Algorithm = algorithm(estimate, estimates[next], join)
+		node = join
+		joined[next] = true
+		if estimates[next] > estimate {
+			estimate = estimates[next]
+		}
+		// Other join conditions between the joined tables become predicates.
+		stillEdges := make([]edge, 0)
+		for _, e := range edges {
+			left, _ := tableOf(e.left, tables)
+			right, _ := tableOf(e.right, tables)
+			if joined[left] && joined[right] {
+				remaining = append(remaining, ra.CmpAlias{e.left, filter.Eq{}, e.right})
+			} else {
+				stillEdges = append(stillEdges, e)
+			}
+		}
+		edges = stillEdges
+		// Evaluate predicates as soon as all of their tables are joined.
+		ready := make([]ra.Predicate, 0)
+		notReady := make([]ra.Predicate, 0)
+		for _, predicate := range remaining {
+			used, _ := tablesOf(predicate, tables)
+			if subset(used, joined) {
+				ready = append(ready, predicate)
+			} else {
+				notReady = append(notReady, predicate)
+			}
+		}
+		if len(ready) > 0 {
+			node = &Select{Input: node, Predicate: all(ready)}
+		}
+		remaining = notReady
+		node = prune(node, joined, tables, edges, remaining, project)
+	}
+	if len(remaining) > 0 {
+		node = &Select{Input: node, Predicate: all(remaining)}
+	}
+	if project != nil {
+		node = &Project{Input: node, Aliases: project.Aliases}
+	}
+	return node, st.OK
+}
+
+// Returns the join algorithm for joining a table to rows of the input.
+func algorithm(inputEstimate, rightEstimate float64, join *Join) int {
+	// Looking up each input row in the index reads only matching rows of the right table,
+	// it is worthwhile if the input has fewer rows than the right table.
+	if join.Right.Table.Index(join.Column) != nil && join.Right.Predicate == nil && inputEstimate < rightEstimate {
+		return NestedLoops
+	}
+	return Hash
+}
+
+// Returns the estimated number of rows in the RA result of a node, the same way the optimizer estimates.
+func Estimate(node Node) float64 {
+	switch n := node.(type) {
+	case *Scan:
+		stats, status := StatisticsOf(n.Table)
+		if status != st.OK {
+			return 0
+		}
+		if n.Predicate == nil {
+			return float64(stats.Rows)
+		}
+		return float64(stats.Rows) * selectivity(n.Predicate)
+	case *Select:
+		return Estimate(n.Input) * selectivity(n.Predicate)
+	case *Join:
+		input, right := Estimate(n.Input), Estimate(n.Right)
+		if n.Kind == ra.Inner || n.Kind == ra.LeftOuter {
+			if right > input {
+				return right
+			}
+			return input
+		}
+		return input + right
+	}
+	children := node.Children()
+	if len(children) == 0 {
+		return 0
+	}
+	return Estimate(children[0])
+}
+
+// Removes aliases of the joined tables which are not used by later join conditions, predicates or the
+// final project. Returns the node unchanged if all aliases are used or there is no final project.
+func prune(node Node, joined map[string]bool, tables map[string]*table.Table, edges []edge, remaining []ra.Predicate, project *Project) Node {
+	if project == nil {
+		return node
+	}
+	used := make(map[string]bool)
+	for _, alias := range project.Aliases {
+		used[alias] = true
+	}
+	for _, e := range edges {
+		used[e.left], used[e.right] = true, true
+	}
+	for _, predicate := range remaining {
+		for _, alias := range predicate.Aliases() {
+			used[alias] = true
+		}
+	}
+	kept := make([]string, 0)
+	pruned := false
+	for name, _ := range joined {
+		for _, alias := range aliasesOf(tables[name]) {
+			if used[alias] {
+				kept = append(kept, alias)
+			} else {
+				pruned = true
+			}
+		}
+	}
+	if !pruned || len(kept) == 0 {
+		return node
+	}
+	return &Project{Input: node, Aliases: kept}
+}
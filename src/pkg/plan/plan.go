@@ -0,0 +1,321 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/*
+Logical query plans.
+A plan is a tree of nodes, the leaves are table scans. Executing the root node runs the relational
+algebras of the whole tree and makes the RA result. Aliases in RA result of a plan are always
+qualified as "table.column".
+*/
+
+package plan
+
+import (
+	"strings"
+	"time"
+	"ra"
+	"table"
+	"snapshot"
+	"st"
+)
+
+// Join algorithms.
+const (
+	NestedLoops = iota // ra.NLJoin, the other table's rows are looked up by index if there is one
+	Hash               // ra.JoinRows, each row of both sides is read once
+)
+
+// A node of query plan.
+type Node interface {
+	// Runs the node (and its children) and returns the RA result.
+	Execute() (*ra.Result, int)
+	// Returns the tables which the node reads.
+	Tables() []*table.Table
+	// Returns the input nodes.
+	Children() []Node
+	// Returns the operation and its parameters, e.g. "Scan PERSON".
+	Describe() string
+	// Returns figures of the last execution.
+	Stats() *Stats
+}
+
+// Figures of the last execution of a node, including its inputs.
+type Stats struct {
+	Executed    bool
+	Rows        int    // number of rows in RA result
+	Reads       int    // number of rows read from tables (see ra.Result.Reads)
+	Nanoseconds int64  // time spent
+	Strategy    string // how rows are found (e.g. index of a column) or joined
+}
+
+// Runs a node and records its figures.
+func run(node Node, execute func() (*ra.Result, int)) (*ra.Result, int) {
+	started := time.Nanoseconds()
+	r, status := execute()
+	stats := node.Stats()
+	stats.Executed = status == st.OK
+	stats.Nanoseconds = time.Nanoseconds() - started
+	if status == st.OK {
+		// Reads of an RA result include those of its input, thus of the node's children.
+		stats.Reads = r.Reads
+		stats.Rows = r.NumberOfRows()
+	}
+	return r, status
+}
+
+// Returns the strategy of finding rows by a predicate, according to the alias whose index is used.
+func access(indexed string) string {
+	if indexed == "" {
+		return "all rows"
+	}
+	return "index on " + indexed
+}
+
+// Makes the scans of a plan read rows as of the snapshot (see package snapshot), without locking tables.
+func InSnapshot(root Node, s *snapshot.Snapshot) {
+	if scan, isScan := root.(*Scan); isScan {
+		scan.Snapshot = s
+	}
+	for _, child := range root.Children() {
+		InSnapshot(child, s)
+	}
+}
+
+// Loads rows of a table which pass the predicate, deleted rows are left out.
+type Scan struct {
+	Table     *table.Table
+	Predicate ra.Predicate       // nil if all rows are loaded
+	Snapshot  *snapshot.Snapshot // rows are read as of the snapshot, nil to read the latest rows
+	stats     Stats
+}
+
+// Keeps rows passing the predicate.
+type Select struct {
+	Input     Node
+	Predicate ra.Predicate
+	stats     Stats
+}
+
+// Joins rows of a table (those of the Right scan) to the input.
+type Join struct {
+	Input     Node
+	Right     *Scan
+	Alias     string // alias in the input
+	Column    string // column of the right table
+	Kind      int    // ra.Inner, ra.LeftOuter, ra.RightOuter or ra.FullOuter
+	Algorithm int    // NestedLoops or Hash, outer joins always use Hash
+	stats     Stats
+}
+
+// Keeps only the aliases.
+type Project struct {
+	Input   Node
+	Aliases []string
+	stats   Stats
+}
+
+// Returns a new scan of the table.
+func NewScan(t *table.Table) *Scan {
+	return &Scan{Table: t}
+}
+
+func (s *Scan) Execute() (*ra.Result, int) {
+	return run(s, func() (*ra.Result, int) { return s.execute() })
+}
+
+func (s *Scan) execute() (*ra.Result, int) {
+	r := ra.New()
+	r.Snapshot = s.Snapshot
+	_, status := r.Load(s.Table)
+	if status != st.OK {
+		return nil, status
+	}
+	_, status = r.Qualify(s.Table.Name)
+	if status != st.OK {
+		return nil, status
+	}
+	indexed := ""
+	if s.Predicate == nil {
+		_, status = r.ExcludeDeleted()
+	} else {
+		_, indexed, status = r.WhereUsing(s.Predicate)
+	}
+	s.stats.Strategy = access(indexed)
+	if status != st.OK {
+		return nil, status
+	}
+	return r, st.OK
+}
+
+func (s *Scan) Tables() []*table.Table {
+	return []*table.Table{s.Table}
+}
+
+func (s *Scan) Children() []Node {
+	return []Node{}
+}
+
+func (s *Scan) Describe() string {
+	if s.Predicate == nil {
+		return "Scan " + s.Table.Name
+	}
+	return "Scan " + s.Table.Name + " where " + describePredicate(s.Predicate)
+}
+
+func (s *Scan) Stats() *Stats {
+	return &s.stats
+}
+
+func (s *Select) Execute() (*ra.Result, int) {
+	return run(s, func() (*ra.Result, int) { return s.execute() })
+}
+
+func (s *Select) execute() (*ra.Result, int) {
+	r, status := s.Input.Execute()
+	if status != st.OK {
+		return nil, status
+	}
+	_, indexed, status := r.WhereUsing(s.Predicate)
+	if status != st.OK {
+		return nil, status
+	}
+	s.stats.Strategy = access(indexed)
+	return r, st.OK
+}
+
+func (s *Select) Tables() []*table.Table {
+	return s.Input.Tables()
+}
+
+func (s *Select) Children() []Node {
+	return []Node{s.Input}
+}
+
+func (s *Select) Describe() string {
+	return "Select " + describePredicate(s.Predicate)
+}
+
+func (s *Select) Stats() *Stats {
+	return &s.stats
+}
+
+func (j *Join) Execute() (*ra.Result, int) {
+	return run(j, func() (*ra.Result, int) { return j.execute() })
+}
+
+func (j *Join) execute() (*ra.Result, int) {
+	r, status := j.Input.Execute()
+	if status != st.OK {
+		return nil, status
+	}
+	if _, exists := r.Aliases[j.Alias]; !exists {
+		return nil, st.AliasNotFound
+	}
+	t := j.Right.Table
+	if j.Algorithm == NestedLoops && j.Kind == ra.Inner {
+		j.stats.Strategy = "nested loops"
+		if t.Index(j.Column) != nil && r.Snapshot == nil {
+			j.stats.Strategy += ", index on " + t.Name + "." + j.Column
+		}
+		_, status = r.NLJoin(j.Alias, t, j.Column)
+		if status == st.OK {
+			_, status = r.Qualify(t.Name)
+		}
+		if status == st.OK && j.Right.Predicate != nil {
+			_, status = r.Where(j.Right.Predicate)
+		}
+	} else {
+		// Only rows of the right table which pass its predicate are joined.
+		j.stats.Strategy = "hash"
+		var rowNumbers []int
+		if j.Right.Predicate != nil {
+			right, status := j.Right.Execute()
+			if status != st.OK {
+				return nil, status
+			}
+			rowNumbers = right.Tables[t.Name].RowNumbers
+			// The right scan is a child, its reads are part of the join.
+			r.Reads += right.Reads
+		}
+		_, status = r.JoinRows(j.Kind, j.Alias, &ra.TableResult{t, rowNumbers}, j.Column)
+		if status == st.OK {
+			_, status = r.Qualify(t.Name)
+		}
+	}
+	if status != st.OK {
+		return nil, status
+	}
+	return r, st.OK
+}
+
+func (j *Join) Tables() []*table.Table {
+	return append(j.Input.Tables(), j.Right.Table)
+}
+
+func (j *Join) Children() []Node {
+	return []Node{j.Input, j.Right}
+}
+
+// Names of join kinds.
+var kinds = map[int]string{ra.Inner: "Join", ra.LeftOuter: "Left join", ra.RightOuter: "Right join",
+	ra.FullOuter: "Full join"}
+
+func (j *Join) Describe() string {
+	return kinds[j.Kind] + " " + j.Right.Table.Name + " on " + j.Alias + " = " + j.Right.Table.Name + "." + j.Column
+}
+
+func (j *Join) Stats() *Stats {
+	return &j.stats
+}
+
+func (p *Project) Execute() (*ra.Result, int) {
+	return run(p, func() (*ra.Result, int) { return p.execute() })
+}
+
+func (p *Project) execute() (*ra.Result, int) {
+	r, status := p.Input.Execute()
+	if status != st.OK {
+		return nil, status
+	}
+	for _, alias := range p.Aliases {
+		if _, exists := r.Aliases[alias]; !exists {
+			return nil, st.AliasNotFound
+		}
+	}
+	_, status = r.Project(p.Aliases...)
+	if status != st.OK {
+		return nil, status
+	}
+	return r, st.OK
+}
+
+func (p *Project) Tables() []*table.Table {
+	return p.Input.Tables()
+}
+
+func (p *Project) Children() []Node {
+	return []Node{p.Input}
+}
+
+func (p *Project) Describe() string {
+	return "Project " + strings.Join(p.Aliases, ", ")
+}
+
+func (p *Project) Stats() *Stats {
+	return &p.stats
+}
@@ -0,0 +1,273 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/* Relational algebra group by and aggregate functions. */
+
+package ra
+
+import (
+	"strconv"
+	"sync/atomic"
+	"column"
+	"constant"
+	"st"
+)
+
+// Aggregate functions.
+const (
+	Count         = "COUNT"          // number of rows
+	CountDistinct = "COUNT DISTINCT" // number of distinct non-empty values
+	Sum           = "SUM"
+	Avg           = "AVG"
+	Min           = "MIN"
+	Max           = "MAX"
+)
+
+// An aggregate function computed for each group. Empty values are ignored, except by Count.
+type Aggregate struct {
+	Function string // one of the aggregate functions
+	Alias    string // alias of the aggregated column, not used by Count
+	As       string // alias of the computed value, must not be empty
+}
+
+// State of an aggregate function in a group.
+type accumulator struct {
+	count    int             // number of rows, or number of non-empty values
+	distinct map[string]bool // distinct values
+	sum      float64
+	intSum   int64  // sum of Int column, kept exact
+	extreme  string // minimum or maximum value
+}
+
+// Number of group by results so far, their tables are named after it.
+var groupTables int32
+
+// A group of rows having the same values of group by aliases.
+type group struct {
+	key          []string
+	accumulators []*accumulator
+}
+
+// Returns true if the value a is less than b, compared as numbers if the column is numeric.
+func less(c *column.Column, a, b string) bool {
+	if c.Type == column.Int || c.Type == column.Float {
+		aNumber, aErr := strconv.Atof64(a)
+		bNumber, bErr := strconv.Atof64(b)
+		if aErr == nil && bErr == nil {
+			return aNumber < bNumber
+		}
+	}
+	return a < b
+}
+
+// Returns the column which an alias refers to.
+func (r *Result) columnOf(alias string) *column.Column {
+	tableColumn := r.Aliases[alias]
+	return r.Tables[tableColumn.TableName].Table.Columns[tableColumn.ColumnName]
+}
+
+// Returns the column holding computed value of an aggregate function.
+func (r *Result) aggregateColumn(aggregate Aggregate) (*column.Column, int) {
+	switch aggregate.Function {
+	case Count, CountDistinct:
+		return &column.Column{Name: aggregate.As, Length: constant.AggregateColumnLength, Type: column.Int}, st.OK
+	case Sum, Avg, Min, Max:
+		_, exists := r.Aliases[aggregate.Alias]
+		if !exists {
+			return nil, r.fail(st.New(st.AliasNotFound).WithColumn(aggregate.Alias))
+		}
+		source := r.columnOf(aggregate.Alias)
+		switch {
+		case aggregate.Function == Min || aggregate.Function == Max:
+			return &column.Column{Name: aggregate.As, Length: source.Length, Type: source.Type}, st.OK
+		case aggregate.Function == Sum && source.Type == column.Int:
+			return &column.Column{Name: aggregate.As, Length: constant.AggregateColumnLength, Type: column.Int}, st.OK
+		}
+		return &column.Column{Name: aggregate.As, Length: constant.AggregateColumnLength, Type: column.Float}, st.OK
+	}
+	return nil, r.fail(st.New(st.InvalidAggregate))
+}
+
+// Feeds a row into the accumulator of an aggregate function.
+func (r *Result) accumulate(acc *accumulator, aggregate Aggregate, row map[string]string) int {
+	if aggregate.Function == Count {
+		acc.count++
+		return st.OK
+	}
+	value := row[aggregate.Alias]
+	if value == "" {
+		return st.OK
+	}
+	switch aggregate.Function {
+	case CountDistinct:
+		if !acc.distinct[value] {
+			acc.distinct[value] = true
+			acc.count++
+		}
+	case Sum, Avg:
+		if aggregate.Function == Sum && r.columnOf(aggregate.Alias).Type == column.Int {
+			number, err := strconv.Atoi64(value)
+			if err != nil {
+				return r.fail(st.New(st.InvalidColumnValue).WithColumn(aggregate.Alias))
+			}
+			acc.intSum += number
+			acc.count++
+			return st.OK
+		}
+		number, err := strconv.Atof64(value)
+		if err != nil {
+			return r.fail(st.New(st.InvalidColumnValue).WithColumn(aggregate.Alias))
+		}
+		acc.sum += number
+		acc.count++
+	case Min, Max:
+		source := r.columnOf(aggregate.Alias)
+		if acc.count == 0 ||
+			(aggregate.Function == Min && less(source, value, acc.extreme)) ||
+			(aggregate.Function == Max && less(source, acc.extreme, value)) {
+			acc.extreme = value
+		}
+		acc.count++
+	}
+	return st.OK
+}
+
+// Returns computed value of an aggregate function.
+func (acc *accumulator) value(aggregate Aggregate, c *column.Column) string {
+	switch aggregate.Function {
+	case Count, CountDistinct:
+		return strconv.Itoa(acc.count)
+	case Sum:
+		if c.Type == column.Int {
+			return strconv.Itoa64(acc.intSum)
+		}
+		return strconv.Ftoa64(acc.sum, 'f', -1)
+	case Avg:
+		if acc.count == 0 {
+			return ""
+		}
+		return strconv.Ftoa64(acc.sum/float64(acc.count), 'f', -1)
+	}
+	return acc.extreme
+}
+
+// Relational algebra group by. Rows having the same values of the aliases form a group, the groups
+// and their computed aggregate values are put into a new RA result, in which the group by aliases
+// and the aggregate aliases are the only aliases. If there is no alias, all rows form one group.
+// Deleted rows, and rows not seen by the snapshot of RA result, are left out.
+func (r *Result) GroupBy(aggregates []Aggregate, aliases ...string) (*Result, int) {
+	// Prepare columns of the new result.
+	columns := make([]*column.Column, 0)
+	defined := make(map[string]bool)
+	for _, alias := range aliases {
+		_, exists := r.Aliases[alias]
+		if !exists {
+			return r, r.fail(st.New(st.AliasNotFound).WithColumn(alias))
+		}
+		source := r.columnOf(alias)
+		columns = append(columns, &column.Column{Name: alias, Length: source.Length, Type: source.Type})
+		defined[alias] = true
+	}
+	aggregateColumns := make([]*column.Column, len(aggregates))
+	for i, aggregate := range aggregates {
+		if aggregate.As == "" {
+			return r, r.fail(st.New(st.InvalidAggregate))
+		}
+		if defined[aggregate.As] {
+			return r, r.fail(st.New(st.DuplicatedAlias).WithColumn(aggregate.As))
+		}
+		var status int
+		aggregateColumns[i], status = r.aggregateColumn(aggregate)
+		if status != st.OK {
+			return r, status
+		}
+		columns = append(columns, aggregateColumns[i])
+		defined[aggregate.As] = true
+	}
+	// Put rows into groups, groups are in the order they are first seen.
+	groups := make([]*group, 0)
+	groupOfKey := make(map[string]*group)
+	newGroup := func(key []string) *group {
+		g := &group{key, make([]*accumulator, len(aggregates))}
+		for i, _ := range aggregates {
+			g.accumulators[i] = &accumulator{distinct: make(map[string]bool)}
+		}
+		groups = append(groups, g)
+		return g
+	}
+	for i := 0; i < r.NumberOfRows(); i++ {
+		tableRows, status := r.readTables(i)
+		if status != st.OK {
+			return r, status
+		}
+		visible := true
+		for _, tableRow := range tableRows {
+			if !r.visible(tableRow) {
+				visible = false
+				break
+			}
+		}
+		if !visible {
+			continue
+		}
+		row := r.aliasValues(tableRows)
+		key := make([]string, len(aliases))
+		var joinedKey string
+		for j, alias := range aliases {
+			key[j] = row[alias]
+			joinedKey += strconv.Quote(row[alias])
+		}
+		g, exists := groupOfKey[joinedKey]
+		if !exists {
+			g = newGroup(key)
+			groupOfKey[joinedKey] = g
+		}
+		for j, aggregate := range aggregates {
+			status = r.accumulate(g.accumulators[j], aggregate, row)
+			if status != st.OK {
+				return r, status
+			}
+		}
+	}
+	// Without group by aliases, there is always one group even if there is no row.
+	if len(aliases) == 0 && len(groups) == 0 {
+		newGroup([]string{})
+	}
+	// Write the groups into a temporary table, named uniquely so that group by results may be joined.
+	name := constant.ThePrefix + "group" + strconv.Itoa(int(atomic.AddInt32(&groupTables, 1)))
+	t, e := temporaryTable(name, columns)
+	if e != nil {
+		return r, r.fail(e)
+	}
+	for _, g := range groups {
+		row := make(map[string]string)
+		for j, alias := range aliases {
+			row[alias] = g.key[j]
+		}
+		for j, aggregate := range aggregates {
+			row[aggregate.As] = g.accumulators[j].value(aggregate, aggregateColumns[j])
+		}
+		status := t.Insert(row)
+		if status != st.OK {
+			return r, r.failed(status, t)
+		}
+	}
+	grouped, status := resultOf(t)
+	grouped.Reads = r.Reads
+	return grouped, status
+}
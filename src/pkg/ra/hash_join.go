@@ -0,0 +1,141 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/* Join a table in RA result with another table using an in-memory hash table. */
+
+package ra
+
+import (
+	"table"
+	"st"
+)
+
+// Reads column value of the rows, each row is read only once and deleted or missing rows are left out.
+func (r *Result) columnValues(t *table.Table, name string, rowNumbers []int) (map[int]string, int) {
+	values := make(map[int]string)
+	read := make(map[int]bool)
+	for _, rowNumber := range rowNumbers {
+		if rowNumber == NullRow || read[rowNumber] {
+			continue
+		}
+		read[rowNumber] = true
+		row, status := r.read(t, rowNumber)
+		if status != st.OK {
+			return nil, status
+		}
+		if r.visible(row) {
+			values[rowNumber] = row[name]
+		}
+	}
+	return values, st.OK
+}
+
+// Matches rows of the table in RA result with rows of t2 using a hash table built on the smaller side.
+// Only the candidate rows of t2 are matched, all rows of t2 are candidates if candidates is nil.
+// Returns t2 row numbers (in the order of candidates) matching each position of RA result, join column
+// values of t1 rows which are not deleted, and t2 row numbers of candidates which are not deleted.
+func (r *Result) hashMatches(alias string, t2 *table.Table, candidates []int, name string) ([][]int, map[int]string, []int, int) {
+	if _, exists := r.Aliases[alias]; !exists {
+		return nil, nil, nil, r.fail(st.New(st.AliasNotFound).WithColumn(alias))
+	}
+	if _, exists := r.Tables[t2.Name]; exists {
+		return nil, nil, nil, r.fail(st.New(st.TableAlreadyExists).WithTable(t2.Name))
+	}
+	// t1 is the table in RA result.
+	t1Column := r.Aliases[alias].ColumnName
+	t1 := r.Tables[r.Aliases[alias].TableName]
+	t1Values, status := r.columnValues(t1.Table, t1Column, t1.RowNumbers)
+	if status != st.OK {
+		return nil, nil, nil, status
+	}
+	// t2 is the external table.
+	if candidates == nil {
+		t2NumberOfRows, status := t2.NumberOfRows()
+		if status != st.OK {
+			return nil, nil, nil, status
+		}
+		candidates = make([]int, t2NumberOfRows)
+		for i := range candidates {
+			candidates[i] = i
+		}
+	}
+	t2Values, status := r.columnValues(t2, name, candidates)
+	if status != st.OK {
+		return nil, nil, nil, status
+	}
+	t2Rows := make([]int, 0)
+	added := make(map[int]bool)
+	for _, t2RowNumber := range candidates {
+		if _, exists := t2Values[t2RowNumber]; exists && !added[t2RowNumber] {
+			t2Rows = append(t2Rows, t2RowNumber)
+			added[t2RowNumber] = true
+		}
+	}
+	matches := make([][]int, len(t1.RowNumbers))
+	hash := make(map[string][]int)
+	if len(t2Values) <= len(t1Values) {
+		// Build on t2 row numbers and probe with t1 rows.
+		for _, t2RowNumber := range t2Rows {
+			value := t2Values[t2RowNumber]
+			hash[value] = append(hash[value], t2RowNumber)
+		}
+		for i, t1RowNumber := range t1.RowNumbers {
+			if value, exists := t1Values[t1RowNumber]; exists {
+				matches[i] = hash[value]
+			}
+		}
+	} else {
+		// Build on positions of RA result and probe with t2 rows.
+		for i, t1RowNumber := range t1.RowNumbers {
+			if value, exists := t1Values[t1RowNumber]; exists {
+				hash[value] = append(hash[value], i)
+			}
+		}
+		for _, t2RowNumber := range t2Rows {
+			for _, i := range hash[t2Values[t2RowNumber]] {
+				matches[i] = append(matches[i], t2RowNumber)
+			}
+		}
+	}
+	return matches, t1Values, t2Rows, st.OK
+}
+
+// Puts t2 into RA result. Position i of the new RA result is made of position positions[i] of the
+// existing RA result (or missing rows if it is -1) and t2 row number t2RowNumbers[i].
+func (r *Result) joined(t2 *table.Table, positions, t2RowNumbers []int) {
+	for _, t := range r.Tables {
+		newRowNumbers := make([]int, len(positions))
+		for i, position := range positions {
+			if position == NullRow {
+				newRowNumbers[i] = NullRow
+			} else {
+				newRowNumbers[i] = t.RowNumbers[position]
+			}
+		}
+		t.RowNumbers = newRowNumbers
+	}
+	// Load columns of t2 into RA result.
+	r.Load(t2)
+	r.Tables[t2.Name].RowNumbers = t2RowNumbers
+}
+
+// Relational algebra join using a hash table built on the smaller side.
+// The result is the same as NLJoin, but each row of both tables is read only once.
+func (r *Result) HashJoin(alias string, t2 *table.Table, name string) (*Result, int) {
+	return r.JoinRows(Inner, alias, &TableResult{t2, nil}, name)
+}
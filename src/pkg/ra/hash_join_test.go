@@ -0,0 +1,122 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package ra
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"column"
+	"table"
+	"st"
+)
+
+// Creates a temporary table of string columns having the rows, rows whose last value is "deleted" are
+// deleted.
+func testTable(t *testing.T, name string, columnNames []string, rows ...[]string) *table.Table {
+	columns := make([]*column.Column, len(columnNames))
+	for i, columnName := range columnNames {
+		columns[i] = &column.Column{Name: columnName, Length: 10, Type: column.String}
+	}
+	tt, e := temporaryTable(name, columns)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for i, values := range rows {
+		row := make(map[string]string)
+		for j, columnName := range columnNames {
+			row[columnName] = values[j]
+		}
+		if status := tt.Insert(row); status != st.OK {
+			t.Fatal(tt.Err())
+		}
+		if len(values) > len(columnNames) && values[len(columnNames)] == "deleted" {
+			tt.Delete(i)
+		}
+	}
+	return tt
+}
+
+// Returns the rows of RA result, each row is the values of the aliases joined by "/", the value of an
+// alias whose row is missing is "-".
+func testRows(t *testing.T, r *Result, aliases ...string) []string {
+	rows := make([]string, r.NumberOfRows())
+	for i := range rows {
+		row, status := r.ReadAliases(i)
+		if status != st.OK {
+			t.Fatal(r.Err())
+		}
+		values := make([]string, len(aliases))
+		for j, alias := range aliases {
+			value, exists := row[alias]
+			if !exists {
+				value = "-"
+			}
+			values[j] = value
+		}
+		rows[i] = strings.Join(values, "/")
+	}
+	return rows
+}
+
+// PERSON.SITE refers to SITE.ID, CHRISTINA has no site. Deleted rows are never joined.
+func people(t *testing.T) (person, site *table.Table) {
+	person = testTable(t, "PERSON", []string{"NAME", "SITE"},
+		[]string{"BUZZ", "A"}, []string{"NIKKI", "B"}, []string{"JOSHUA", "A"}, []string{"CHRISTINA", ""},
+		[]string{"GONE", "A", "deleted"})
+	site = testTable(t, "SITE", []string{"ID", "CITY"},
+		[]string{"A", "X"}, []string{"B", "Y"}, []string{"C", "Z"}, []string{"D", "W", "deleted"})
+	return
+}
+
+var hashJoinTests = []struct {
+	name     string
+	fromSite bool // RA result has SITE and PERSON is joined, otherwise the reverse
+	join     func(r *Result, alias string, t2 *table.Table, name string) (*Result, int)
+	rows     []string // NAME/CITY
+}{
+	{"hash join", false, (*Result).HashJoin, []string{"BUZZ/X", "NIKKI/Y", "JOSHUA/X"}},
+	{"nested loops", false, (*Result).NLJoin, []string{"BUZZ/X", "NIKKI/Y", "JOSHUA/X"}},
+	// The hash table is built on the other side.
+	{"hash join from site", true, (*Result).HashJoin, []string{"BUZZ/X", "JOSHUA/X", "NIKKI/Y"}},
+	{"nested loops from site", true, (*Result).NLJoin, []string{"BUZZ/X", "JOSHUA/X", "NIKKI/Y"}},
+}
+
+func TestHashJoin(t *testing.T) {
+	for _, test := range hashJoinTests {
+		person, site := people(t)
+		r := New()
+		var status int
+		if test.fromSite {
+			r.Load(site)
+			_, status = test.join(r, "ID", person, "SITE")
+		} else {
+			r.Load(person)
+			_, status = test.join(r, "SITE", site, "ID")
+		}
+		if status != st.OK {
+			t.Errorf("%s: join returned %s", test.name, r.Err())
+			continue
+		}
+		rows := testRows(t, r, "NAME", "CITY")
+		if fmt.Sprint(rows) != fmt.Sprint(test.rows) {
+			t.Errorf("%s: rows are %v, want %v", test.name, rows, test.rows)
+		}
+	}
+}
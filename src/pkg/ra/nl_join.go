@@ -25,6 +25,27 @@ import (
 	"st"
 )
 
+// Returns row numbers of t2 to be joined with a value, using index of the column if there is one
+// (and the RA result does not read a snapshot).
+func (r *Result) inner(t2 *table.Table, name, value string, t2NumberOfRows int) ([]int, int) {
+	if idx := t2.Index(name); idx != nil && r.Snapshot == nil {
+		key, valid := t2.IndexKey(name, value)
+		if !valid {
+			return []int{}, st.OK
+		}
+		rowNumbers, status := idx.Lookup(key)
+		if status != st.OK {
+			return nil, r.fail(st.From(status, idx.Err()).WithTable(t2.Name).WithColumn(name))
+		}
+		return rowNumbers, st.OK
+	}
+	rowNumbers := make([]int, t2NumberOfRows)
+	for i := range rowNumbers {
+		rowNumbers[i] = i
+	}
+	return rowNumbers, st.OK
+}
+
 // Relational algebra join using nested loops.
 func (r *Result) NLJoin(alias string, t2 *table.Table, name string) (*Result, int) {
 	// t1 is the table in RA result.
@@ -34,7 +55,7 @@ func (r *Result) NLJoin(alias string, t2 *table.Table, name string) (*Result, in
 	// t2 is the external table.
 	t2NumberOfRows, status := t2.NumberOfRows()
 	if status != st.OK {
-		return r, status
+		return r, r.failed(status, t2)
 	}
 	// Prepare to re-arrange the sequence of row numbers of all existing tables in RA result.
 	newRowNumbers := make(map[string][]int)
@@ -43,16 +64,25 @@ func (r *Result) NLJoin(alias string, t2 *table.Table, name string) (*Result, in
 	}
 	// NL begins.
 	for i, t1RowNumber := range t1.RowNumbers {
-		for t2RowNumber := 0; t2RowNumber < t2NumberOfRows; t2RowNumber++ {
-			t1Row, status := t1.Table.Read(t1RowNumber)
-			if status != st.OK {
-				return r, status
-			}
-			t2Row, status := t2.Read(t2RowNumber)
+		// A missing row does not match any row.
+		if t1RowNumber == NullRow {
+			continue
+		}
+		t1Row, status := r.read(t1.Table, t1RowNumber)
+		if status != st.OK {
+			return r, status
+		}
+		// Inner loop goes through t2 rows having the value, if t2 column is indexed.
+		t2Candidates, status := r.inner(t2, name, t1Row[t1Column], t2NumberOfRows)
+		if status != st.OK {
+			return r, status
+		}
+		for _, t2RowNumber := range t2Candidates {
+			t2Row, status := r.read(t2, t2RowNumber)
 			if status != st.OK {
 				return r, status
 			}
-			if t1Row["~del"] != "y" && t2Row["~del"] != "y" && t1Row[t1Column] == t2Row[name] {
+			if r.visible(t1Row) && r.visible(t2Row) && t1Row[t1Column] == t2Row[name] {
 				for name, _ := range newRowNumbers {
 					newRowNumbers[name] = append(newRowNumbers[name][:], r.Tables[name].RowNumbers[i])
 				}
@@ -0,0 +1,92 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/*
+Outer joins of a table in RA result with another table.
+Rows which do not have a match on the other side are kept, the other side's row is missing (NullRow).
+*/
+
+package ra
+
+import (
+	"table"
+	"st"
+)
+
+// Kinds of join.
+const (
+	Inner      = iota // only matching rows
+	LeftOuter         // and unmatched rows of RA result
+	RightOuter        // and unmatched rows of the other table
+	FullOuter         // and unmatched rows of both sides
+)
+
+// Joins rows of t2 (e.g. rows which passed a select) using a hash table, all rows of t2 are joined if
+// t2.RowNumbers is nil. Deleted rows are never kept.
+func (r *Result) JoinRows(kind int, alias string, t2 *TableResult, name string) (*Result, int) {
+	keepLeft := kind == LeftOuter || kind == FullOuter
+	keepRight := kind == RightOuter || kind == FullOuter
+	matches, t1Values, t2Rows, status := r.hashMatches(alias, t2.Table, t2.RowNumbers, name)
+	if status != st.OK {
+		return r, status
+	}
+	t1 := r.Tables[r.Aliases[alias].TableName]
+	positions := make([]int, 0)
+	t2RowNumbers := make([]int, 0)
+	matched := make(map[int]bool)
+	for i, t2Matches := range matches {
+		for _, t2RowNumber := range t2Matches {
+			positions = append(positions, i)
+			t2RowNumbers = append(t2RowNumbers, t2RowNumber)
+			matched[t2RowNumber] = true
+		}
+		if len(t2Matches) == 0 && keepLeft {
+			// Rows of RA result which are missing in t1 (made by a previous outer join) are kept too.
+			_, exists := t1Values[t1.RowNumbers[i]]
+			if exists || t1.RowNumbers[i] == NullRow {
+				positions = append(positions, i)
+				t2RowNumbers = append(t2RowNumbers, NullRow)
+			}
+		}
+	}
+	if keepRight {
+		for _, t2RowNumber := range t2Rows {
+			if !matched[t2RowNumber] {
+				positions = append(positions, NullRow)
+				t2RowNumbers = append(t2RowNumbers, t2RowNumber)
+			}
+		}
+	}
+	r.joined(t2.Table, positions, t2RowNumbers)
+	return r, st.OK
+}
+
+// Relational algebra left outer join, rows of RA result are kept even if they do not match any t2 row.
+func (r *Result) LeftJoin(alias string, t2 *table.Table, name string) (*Result, int) {
+	return r.JoinRows(LeftOuter, alias, &TableResult{t2, nil}, name)
+}
+
+// Relational algebra right outer join, rows of t2 are kept even if they do not match any row of RA result.
+func (r *Result) RightJoin(alias string, t2 *table.Table, name string) (*Result, int) {
+	return r.JoinRows(RightOuter, alias, &TableResult{t2, nil}, name)
+}
+
+// Relational algebra full outer join, unmatched rows of both sides are kept.
+func (r *Result) FullJoin(alias string, t2 *table.Table, name string) (*Result, int) {
+	return r.JoinRows(FullOuter, alias, &TableResult{t2, nil}, name)
+}
@@ -0,0 +1,75 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package ra
+
+import (
+	"fmt"
+	"testing"
+	"st"
+)
+
+var outerJoinTests = []struct {
+	name       string
+	kind       int
+	candidates []int    // rows of SITE which are joined, nil for all rows
+	rows       []string // NAME/CITY, "-" if the row is missing
+}{
+	{"inner", Inner, nil, []string{"BUZZ/X", "NIKKI/Y", "JOSHUA/X"}},
+	{"left", LeftOuter, nil, []string{"BUZZ/X", "NIKKI/Y", "JOSHUA/X", "CHRISTINA/-"}},
+	{"right", RightOuter, nil, []string{"BUZZ/X", "NIKKI/Y", "JOSHUA/X", "-/Z"}},
+	{"full", FullOuter, nil, []string{"BUZZ/X", "NIKKI/Y", "JOSHUA/X", "CHRISTINA/-", "-/Z"}},
+	{"left with candidates", LeftOuter, []int{0}, []string{"BUZZ/X", "NIKKI/-", "JOSHUA/X", "CHRISTINA/-"}},
+	{"right with candidates", RightOuter, []int{1, 2}, []string{"NIKKI/Y", "-/Z"}},
+	{"full with deleted candidate", FullOuter, []int{2, 3}, []string{"BUZZ/-", "NIKKI/-", "JOSHUA/-", "CHRISTINA/-", "-/Z"}},
+}
+
+func TestJoinRows(t *testing.T) {
+	for _, test := range outerJoinTests {
+		person, site := people(t)
+		r := New()
+		r.Load(person)
+		if _, status := r.JoinRows(test.kind, "SITE", &TableResult{site, test.candidates}, "ID"); status != st.OK {
+			t.Errorf("%s: JoinRows returned %s", test.name, r.Err())
+			continue
+		}
+		rows := testRows(t, r, "NAME", "CITY")
+		if fmt.Sprint(rows) != fmt.Sprint(test.rows) {
+			t.Errorf("%s: rows are %v, want %v", test.name, rows, test.rows)
+		}
+	}
+}
+
+// Rows left unmatched by an outer join are kept by the next outer join.
+func TestOuterJoinChain(t *testing.T) {
+	person, site := people(t)
+	city := testTable(t, "CITYINFO", []string{"CNAME", "COUNTRY"}, []string{"X", "NZ"}, []string{"Z", "AU"})
+	r := New()
+	r.Load(person)
+	if _, status := r.FullJoin("SITE", site, "ID"); status != st.OK {
+		t.Fatal(r.Err())
+	}
+	if _, status := r.LeftJoin("CITY", city, "CNAME"); status != st.OK {
+		t.Fatal(r.Err())
+	}
+	rows := testRows(t, r, "NAME", "CITY", "COUNTRY")
+	want := []string{"BUZZ/X/NZ", "NIKKI/Y/-", "JOSHUA/X/NZ", "CHRISTINA/-/-", "-/Z/AU"}
+	if fmt.Sprint(rows) != fmt.Sprint(want) {
+		t.Errorf("rows are %v, want %v", rows, want)
+	}
+}
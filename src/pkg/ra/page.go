@@ -0,0 +1,172 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/*
+Limit, offset and pagination of RA result.
+A cursor is an opaque token which tells where the next page begins. LoadPage reads a table from
+the cursor and stops once the page is full, Page pages through an existing RA result.
+*/
+
+package ra
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"table"
+	"st"
+)
+
+// Kinds of cursor.
+const (
+	rowCursor      = "row"      // the next row number of a table, used by LoadPage
+	positionCursor = "position" // the next position of RA result, used by Page
+)
+
+// Returns a cursor token.
+func encodeCursor(kind, tableName string, next int) string {
+	return hex.EncodeToString([]byte(kind + ":" + strconv.Itoa(next) + ":" + tableName))
+}
+
+// Returns the next row number (or position) from a cursor token. Empty token is the beginning.
+func decodeCursor(cursor, kind, tableName string) (int, int) {
+	if cursor == "" {
+		return 0, st.OK
+	}
+	decoded, err := hex.DecodeString(cursor)
+	if err != nil {
+		return 0, st.InvalidCursor
+	}
+	parts := strings.SplitN(string(decoded), ":", 3)
+	if len(parts) != 3 || parts[0] != kind || parts[2] != tableName {
+		return 0, st.InvalidCursor
+	}
+	next, err := strconv.Atoi(parts[1])
+	if err != nil || next < 0 {
+		return 0, st.InvalidCursor
+	}
+	return next, st.OK
+}
+
+// Keeps the rows at positions [from, to) of RA result.
+func (r *Result) keepRange(from, to int) {
+	if to > r.NumberOfRows() {
+		to = r.NumberOfRows()
+	}
+	kept := make([]int, 0)
+	for i := from; i < to; i++ {
+		kept = append(kept, i)
+	}
+	r.keep(kept)
+}
+
+// Keeps only the first n rows of RA result.
+func (r *Result) Limit(n int) (*Result, int) {
+	if n < 0 {
+		return r, r.fail(st.New(st.InvalidLimit))
+	}
+	r.keepRange(0, n)
+	return r, st.OK
+}
+
+// Removes the first k rows of RA result.
+func (r *Result) Offset(k int) (*Result, int) {
+	if k < 0 {
+		return r, r.fail(st.New(st.InvalidLimit))
+	}
+	r.keepRange(k, r.NumberOfRows())
+	return r, st.OK
+}
+
+// Keeps at most limit rows of RA result, beginning from the cursor.
+// Returns the cursor of the next page, or empty string if this is the last page.
+func (r *Result) Page(cursor string, limit int) (*Result, string, int) {
+	if limit <= 0 {
+		return r, "", r.fail(st.New(st.InvalidLimit))
+	}
+	from, status := decodeCursor(cursor, positionCursor, "")
+	if status != st.OK {
+		return r, "", r.fail(st.New(status))
+	}
+	next := ""
+	if from+limit < r.NumberOfRows() {
+		next = encodeCursor(positionCursor, "", from+limit)
+	}
+	r.keepRange(from, from+limit)
+	return r, next, st.OK
+}
+
+// Loads at most limit rows of a table which pass the conditions, beginning from the cursor.
+// Deleted rows are left out. Aliases of conditions are the table's column names.
+// The table is read only until the page is full, so the RA result must not have tables (ResultIsNotEmpty).
+// Returns the cursor of the next page, or empty string if the whole table has been read.
+func (r *Result) LoadPage(t *table.Table, cursor string, limit int, conditions ...Condition) (*Result, string, int) {
+	if limit <= 0 {
+		return r, "", r.fail(st.New(st.InvalidLimit))
+	}
+	if _, exists := r.Tables[t.Name]; exists {
+		return r, "", r.fail(st.New(st.TableAlreadyExists).WithTable(t.Name))
+	}
+	if len(r.Tables) > 0 {
+		return r, "", r.fail(st.New(st.ResultIsNotEmpty).WithTable(t.Name))
+	}
+	for _, condition := range conditions {
+		if _, exists := t.Columns[condition.Alias]; !exists {
+			return r, "", r.fail(st.New(st.AliasNotFound).WithColumn(condition.Alias))
+		}
+	}
+	from, status := decodeCursor(cursor, rowCursor, t.Name)
+	if status != st.OK {
+		return r, "", r.fail(st.New(status).WithTable(t.Name))
+	}
+	numberOfRows, status := t.NumberOfRows()
+	if status != st.OK {
+		return r, "", r.failed(status, t)
+	}
+	rowNumbers := make([]int, 0)
+	next := ""
+	for i := from; i < numberOfRows; i++ {
+		if len(rowNumbers) == limit {
+			next = encodeCursor(rowCursor, t.Name, i)
+			break
+		}
+		row, status := r.read(t, i)
+		if status != st.OK {
+			return r, "", status
+		}
+		if !r.visible(row) {
+			continue
+		}
+		passed := true
+		for _, condition := range conditions {
+			if !condition.Filter.Cmp(row[condition.Alias], condition.Parameter) {
+				passed = false
+				break
+			}
+		}
+		if passed {
+			rowNumbers = append(rowNumbers, i)
+		}
+	}
+	_, status = r.Load(t)
+	if status != st.OK {
+		return r, "", status
+	}
+	r.Tables[t.Name].RowNumbers = rowNumbers
+	return r, next, st.OK
+}
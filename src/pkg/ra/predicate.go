@@ -0,0 +1,212 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/*
+Boolean predicates for relational algebra select.
+A predicate tree (e.g. Or{Cmp{"NAME", filter.Eq{}, "x"}, Cmp{"SITE", filter.Eq{}, "y"}}) is evaluated
+on each row of RA result in a single pass.
+*/
+
+package ra
+
+import (
+	"filter"
+	"st"
+)
+
+// A boolean condition on a row of RA result.
+type Predicate interface {
+	// Tests the row (alias1:value1, alias2:value2...), aliases of missing rows are absent.
+	Eval(row map[string]string) bool
+	// Returns the aliases which the predicate uses.
+	Aliases() []string
+}
+
+// True if all of the predicates are true.
+type And []Predicate
+
+// True if any of the predicates is true.
+type Or []Predicate
+
+// True if the predicate is false.
+type Not struct {
+	Predicate Predicate
+}
+
+// Compares an alias with a constant. Always false if the alias has no value (missing row).
+type Cmp struct {
+	Alias     string
+	Filter    filter.Filter
+	Parameter interface{}
+}
+
+// Compares an alias with another alias. Always false if either alias has no value (missing row).
+type CmpAlias struct {
+	Alias  string
+	Filter filter.Filter
+	Other  string
+}
+
+func (p And) Eval(row map[string]string) bool {
+	for _, predicate := range p {
+		if !predicate.Eval(row) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p And) Aliases() []string {
+	return aliasesOf(p)
+}
+
+func (p Or) Eval(row map[string]string) bool {
+	for _, predicate := range p {
+		if predicate.Eval(row) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Or) Aliases() []string {
+	return aliasesOf(p)
+}
+
+func (p Not) Eval(row map[string]string) bool {
+	return !p.Predicate.Eval(row)
+}
+
+func (p Not) Aliases() []string {
+	return p.Predicate.Aliases()
+}
+
+func (p Cmp) Eval(row map[string]string) bool {
+	value, exists := row[p.Alias]
+	return exists && p.Filter.Cmp(value, p.Parameter)
+}
+
+func (p Cmp) Aliases() []string {
+	return []string{p.Alias}
+}
+
+func (p CmpAlias) Eval(row map[string]string) bool {
+	value, exists := row[p.Alias]
+	other, otherExists := row[p.Other]
+	return exists && otherExists && p.Filter.Cmp(value, other)
+}
+
+func (p CmpAlias) Aliases() []string {
+	return []string{p.Alias, p.Other}
+}
+
+// Returns the aliases used by the predicates.
+func aliasesOf(predicates []Predicate) []string {
+	aliases := make([]string, 0)
+	for _, predicate := range predicates {
+		aliases = append(aliases, predicate.Aliases()...)
+	}
+	return aliases
+}
+
+// Returns positions of RA result which may pass the predicate according to column indexes.
+// The second return value is the alias whose index is used, empty if there is no index to use.
+func (r *Result) possiblePositions(p Predicate) (map[int]bool, string, int) {
+	// Only comparisons which must be true (the predicate itself or a part of top-level And) narrow the rows.
+	comparisons := []Predicate{p}
+	if and, isAnd := p.(And); isAnd {
+		comparisons = and
+	}
+	for _, predicate := range comparisons {
+		cmp, isCmp := predicate.(Cmp)
+		if !isCmp {
+			continue
+		}
+		column := r.Aliases[cmp.Alias]
+		t := r.Tables[column.TableName]
+		possible, indexed, status := r.candidates(t.Table, column.ColumnName, cmp.Filter, cmp.Parameter)
+		if status != st.OK {
+			return nil, "", status
+		}
+		if indexed {
+			positions := make(map[int]bool)
+			for i, rowNumber := range t.RowNumbers {
+				if possible[rowNumber] {
+					positions[i] = true
+				}
+			}
+			return positions, cmp.Alias, st.OK
+		}
+	}
+	return nil, "", st.OK
+}
+
+// Relational algebra select using a predicate, rows are read once and the predicate is evaluated
+// on each row. Rows which are deleted in any table used by the predicate are not kept.
+func (r *Result) Where(p Predicate) (*Result, int) {
+	_, _, status := r.WhereUsing(p)
+	return r, status
+}
+
+// Same as Where, also returns the alias whose column index is used to find the rows, or empty string
+// if all rows are read.
+func (r *Result) WhereUsing(p Predicate) (*Result, string, int) {
+	// Tables used by the predicate, and their aliases.
+	aliasesOfTable := make(map[string][]string)
+	for _, alias := range p.Aliases() {
+		column, exists := r.Aliases[alias]
+		if !exists {
+			return r, "", r.fail(st.New(st.AliasNotFound).WithColumn(alias))
+		}
+		aliasesOfTable[column.TableName] = append(aliasesOfTable[column.TableName], alias)
+	}
+	possible, indexed, status := r.possiblePositions(p)
+	if status != st.OK {
+		return r, "", status
+	}
+	kept := make([]int, 0)
+	for i := 0; i < r.NumberOfRows(); i++ {
+		if indexed != "" && !possible[i] {
+			continue
+		}
+		row := make(map[string]string)
+		deleted := false
+		for tableName, aliases := range aliasesOfTable {
+			t := r.Tables[tableName]
+			if t.RowNumbers[i] == NullRow {
+				continue
+			}
+			tableRow, status := r.read(t.Table, t.RowNumbers[i])
+			if status != st.OK {
+				return r, "", status
+			}
+			if !r.visible(tableRow) {
+				deleted = true
+				break
+			}
+			for _, alias := range aliases {
+				row[alias] = tableRow[r.Aliases[alias].ColumnName]
+			}
+		}
+		if !deleted && p.Eval(row) {
+			kept = append(kept, i)
+		}
+	}
+	r.keep(kept)
+	return r, indexed, st.OK
+}
@@ -0,0 +1,60 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package ra
+
+import (
+	"fmt"
+	"testing"
+	"filter"
+	"st"
+)
+
+var whereTests = []struct {
+	predicate Predicate
+	names     []string // NAME of the kept rows, "-" if the PERSON row is missing
+}{
+	{Cmp{"CITY", filter.Eq{}, "X"}, []string{"BUZZ", "JOSHUA"}},
+	{Or{Cmp{"NAME", filter.Eq{}, "NIKKI"}, Cmp{"CITY", filter.Eq{}, "Z"}}, []string{"NIKKI", "-"}},
+	// A comparison of a missing value is false, thus its negation is true.
+	{Not{Cmp{"CITY", filter.Eq{}, "X"}}, []string{"NIKKI", "CHRISTINA", "-"}},
+	{And{Cmp{"SITE", filter.Eq{}, "A"}, Not{Cmp{"NAME", filter.Eq{}, "BUZZ"}}}, []string{"JOSHUA"}},
+	{CmpAlias{"SITE", filter.Eq{}, "ID"}, []string{"BUZZ", "NIKKI", "JOSHUA"}},
+	{Or{And{Cmp{"CITY", filter.Eq{}, "Y"}}, And{Cmp{"NAME", filter.Prefix{}, "C"}}}, []string{"NIKKI", "CHRISTINA"}},
+	{And{}, []string{"BUZZ", "NIKKI", "JOSHUA", "CHRISTINA", "-"}},
+	{Or{}, []string{}},
+}
+
+func TestWhere(t *testing.T) {
+	for _, test := range whereTests {
+		person, site := people(t)
+		r := New()
+		r.Load(person)
+		if _, status := r.FullJoin("SITE", site, "ID"); status != st.OK {
+			t.Fatal(r.Err())
+		}
+		if _, status := r.Where(test.predicate); status != st.OK {
+			t.Errorf("Where(%v) returned %s", test.predicate, r.Err())
+			continue
+		}
+		names := testRows(t, r, "NAME")
+		if fmt.Sprint(names) != fmt.Sprint(test.names) {
+			t.Errorf("Where(%v) kept %v, want %v", test.predicate, names, test.names)
+		}
+	}
+}
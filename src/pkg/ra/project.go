@@ -25,6 +25,7 @@ import (
 )
 
 // Relational algebra project.
+// Rows are kept even if the rows of all remaining tables are missing (NullRow), such rows have no value.
 func (r *Result) Project(aliases ...string) (*Result, int) {
 	for presentAlias, _ := range r.Aliases {
 		found := false
@@ -17,7 +17,7 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 */
 
 /*
-Redefine (renames) an alias in RA result. 
+Redefine (renames) an alias in RA result.
 Very useful when joining two tables but they have common column names.
 */
 
@@ -31,13 +31,31 @@ import (
 func (r *Result) Redefine(oldName, newName string) (*Result, int) {
 	_, exists := r.Aliases[oldName]
 	if !exists {
-		return r, st.AliasNotFound
+		return r, r.fail(st.New(st.AliasNotFound).WithColumn(oldName))
 	}
 	_, exists = r.Aliases[newName]
 	if exists {
-		return r, st.AliasAlreadyExists
+		return r, r.fail(st.New(st.AliasAlreadyExists).WithColumn(newName))
 	}
 	r.Aliases[newName] = r.Aliases[oldName]
 	r.Aliases[oldName] = nil, false
 	return r, st.OK
 }
+
+// Redefines aliases of a table in RA result which are the table's column names as "table.column".
+// Useful when the tables in RA result have common column names.
+func (r *Result) Qualify(tableName string) (*Result, int) {
+	plain := make([]string, 0)
+	for alias, column := range r.Aliases {
+		if column.TableName == tableName && alias == column.ColumnName {
+			plain = append(plain, alias)
+		}
+	}
+	for _, alias := range plain {
+		_, status := r.Redefine(alias, tableName+"."+alias)
+		if status != st.OK {
+			return r, status
+		}
+	}
+	return r, st.OK
+}
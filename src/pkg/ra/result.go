@@ -26,9 +26,14 @@ import (
 	"table"
 	"logg"
 	"fmt"
+	"snapshot"
 	"st"
 )
 
+// Row number of a missing row, the table's aliases do not have values in such rows of RA result.
+// Missing rows are made by outer joins.
+const NullRow = -1
+
 // Table and the selected rows in the table.
 type TableResult struct {
 	Table      *table.Table
@@ -44,6 +49,12 @@ type TableColumn struct {
 type Result struct {
 	Tables  map[string]*TableResult
 	Aliases map[string]*TableColumn
+	// Rows are read as of the snapshot if it is not nil, otherwise the latest rows are read.
+	Snapshot *snapshot.Snapshot
+	Reads    int // number of rows read from tables by operations of the RA result (and its source)
+	// Memory (in bytes) which Sort may use before it sorts in temporary files, 0 for SortMemoryBudget.
+	SortMemory int
+	err        *st.Error // error of the latest failed operation
 }
 
 // Initializes a new Result.
@@ -54,9 +65,39 @@ func New() (r *Result) {
 	return
 }
 
-// Returns a copy of the Result. 
+// Returns the error of the latest failed operation on the RA result, naming the table and alias
+// (as column) involved, or nil if no operation has failed.
+func (r *Result) Err() *st.Error {
+	return r.err
+}
+
+// Remembers the error of a failed operation, returns its status code.
+func (r *Result) fail(e *st.Error) int {
+	r.err = e
+	return e.Code
+}
+
+// Remembers the error of a failed operation on a table, the table's error tells more if it has the status.
+func (r *Result) failed(status int, t *table.Table) int {
+	return r.fail(st.From(status, t.Err()).WithTable(t.Name))
+}
+
+// Reads a row of a table for an operation of RA result and counts it in Reads.
+func (r *Result) read(t *table.Table, rowNumber int) (map[string]string, int) {
+	r.Reads++
+	row, status := t.Read(rowNumber)
+	if status != st.OK {
+		return nil, r.failed(status, t)
+	}
+	return row, st.OK
+}
+
+// Returns a copy of the Result.
 func (r *Result) Copy() *Result {
 	aCopy := New()
+	aCopy.Snapshot = r.Snapshot
+	aCopy.Reads = r.Reads
+	aCopy.SortMemory = r.SortMemory
 	// Copy row numbers and tables.
 	for str, tableResult := range r.Tables {
 		trCopy := new(TableResult)
@@ -82,13 +123,13 @@ func (r *Result) Copy() *Result {
 func (r *Result) Load(t *table.Table) (*Result, int) {
 	_, exists := r.Tables[t.Name]
 	if exists {
-		return r, st.TableAlreadyExists
+		return r, r.fail(st.New(st.TableAlreadyExists).WithTable(t.Name))
 	}
 	// rowNumbers = list(range(t.NumberOfRows()))
 	rowNumbers := make([]int, 0)
 	numberOfRows, status := t.NumberOfRows()
 	if status != st.OK {
-		return r, status
+		return r, r.failed(status, t)
 	}
 	for i := 0; i < numberOfRows; i++ {
 		rowNumbers = append(rowNumbers[:], i)
@@ -107,6 +148,15 @@ func (r *Result) Load(t *table.Table) (*Result, int) {
 	return r, st.OK
 }
 
+// Returns true if a table row is in the RA result's view: seen by its snapshot, or not deleted if
+// there is no snapshot.
+func (r *Result) visible(row map[string]string) bool {
+	if r.Snapshot != nil {
+		return r.Snapshot.Visible(row)
+	}
+	return row["~del"] != "y"
+}
+
 // For debugging purpose, prints the RA result.
 func (r *Result) Report() {
 	var content string
@@ -120,20 +170,60 @@ func (r *Result) Report() {
 }
 
 // Reads a row and return a map representation (name1:value1, name2:value2...)
+// Columns of a table whose row is missing (NullRow) are absent from the map.
 func (r *Result) Read(rowNumber int) (map[string]string, int) {
 	row := make(map[string]string)
+	tableRows, status := r.readTables(rowNumber)
+	if status != st.OK {
+		return nil, status
+	}
 	for _, column := range r.Aliases {
-		columnName := column.ColumnName
-		table := r.Tables[column.TableName]
-		tableRow, status := table.Table.Read(table.RowNumbers[rowNumber])
-		if status != st.OK {
-			break
+		tableRow, exists := tableRows[column.TableName]
+		if exists {
+			row[column.ColumnName] = tableRow[column.ColumnName]
 		}
-		row[columnName] = tableRow[columnName]
 	}
 	return row, st.OK
 }
 
+// Reads a row and return a map representation keyed by aliases (alias1:value1, alias2:value2...)
+// Aliases of a table whose row is missing (NullRow) are absent from the map.
+func (r *Result) ReadAliases(rowNumber int) (map[string]string, int) {
+	tableRows, status := r.readTables(rowNumber)
+	if status != st.OK {
+		return nil, status
+	}
+	return r.aliasValues(tableRows), st.OK
+}
+
+// Returns the values of table rows read by readTables, keyed by aliases.
+func (r *Result) aliasValues(tableRows map[string]map[string]string) map[string]string {
+	row := make(map[string]string)
+	for alias, column := range r.Aliases {
+		tableRow, exists := tableRows[column.TableName]
+		if exists {
+			row[alias] = tableRow[column.ColumnName]
+		}
+	}
+	return row
+}
+
+// Reads the table rows making up a row of RA result (table name:table row), missing rows are left out.
+func (r *Result) readTables(rowNumber int) (map[string]map[string]string, int) {
+	tableRows := make(map[string]map[string]string)
+	for name, table := range r.Tables {
+		if table.RowNumbers[rowNumber] == NullRow {
+			continue
+		}
+		tableRow, status := r.read(table.Table, table.RowNumbers[rowNumber])
+		if status != st.OK {
+			return nil, status
+		}
+		tableRows[name] = tableRow
+	}
+	return tableRows, st.OK
+}
+
 // Returns the number of rows in RA result.
 func (r *Result) NumberOfRows() int {
 	// All tables have equal number of rows.
@@ -147,7 +237,7 @@ func (r *Result) NumberOfRows() int {
 func (r *Result) Table(name string) (*TableResult, int) {
 	t, exists := r.Tables[name]
 	if !exists {
-		return nil, st.TableNotFound
+		return nil, r.fail(st.New(st.TableNotFound).WithTable(name))
 	}
 	return t, st.OK
 }
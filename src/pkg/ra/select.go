@@ -21,10 +21,119 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package ra
 
 import (
+	"fmt"
 	"filter"
+	"index"
+	"table"
+	"column"
 	"st"
 )
 
+// Returns the bounds of index keys which may pass a range filter.
+// The last return value is false if the filter does not have a range.
+func keyRange(t *table.Table, columnName string, f filter.Filter, parameter interface{}) (*index.Bound, *index.Bound, bool) {
+	key := func(value interface{}) (string, bool) {
+		return t.IndexKey(columnName, fmt.Sprint(value))
+	}
+	var mode filter.Mode
+	var low, high *index.Bound
+	switch f := f.(type) {
+	case filter.Lt, filter.Le, filter.Gt, filter.Ge:
+		k, valid := key(parameter)
+		if !valid {
+			return nil, nil, false
+		}
+		switch f := f.(type) {
+		case filter.Lt:
+			mode, high = f.Mode, &index.Bound{k, false}
+		case filter.Le:
+			mode, high = f.Mode, &index.Bound{k, true}
+		case filter.Gt:
+			mode, low = f.Mode, &index.Bound{k, false}
+		case filter.Ge:
+			mode, low = f.Mode, &index.Bound{k, true}
+		}
+	case filter.Between:
+		bounds := filter.List(parameter)
+		if len(bounds) != 2 {
+			return nil, nil, false
+		}
+		lowKey, lowValid := key(bounds[0])
+		highKey, highValid := key(bounds[1])
+		if !lowValid || !highValid {
+			return nil, nil, false
+		}
+		mode, low, high = f.Mode, &index.Bound{lowKey, true}, &index.Bound{highKey, true}
+	default:
+		return nil, nil, false
+	}
+	// Index keys are ordered as numbers only for numeric columns, text comparison does not follow the order.
+	return low, high, mode.Or(filter.Numeric) != filter.Text
+}
+
+// Returns the row numbers having any of the values according to index of the column.
+// The second return value is false if the index cannot be used.
+func lookup(t *table.Table, idx *index.Index, columnName string, mode filter.Mode, values []interface{}) ([]int, bool, int) {
+	numeric := idx.Type == column.Int || idx.Type == column.Float
+	// Numeric comparison finds equal numbers written differently, only keys of numeric columns are normalized.
+	if mode != filter.Text && !numeric {
+		return nil, false, st.OK
+	}
+	rows := make([]int, 0)
+	for _, value := range values {
+		key, valid := t.IndexKey(columnName, fmt.Sprint(value))
+		if !valid {
+			if mode == filter.Text {
+				// No value of the column is equal to the text.
+				continue
+			}
+			return nil, false, st.OK
+		}
+		found, status := idx.Lookup(key)
+		if status != st.OK {
+			return nil, false, status
+		}
+		rows = append(rows, found...)
+	}
+	return rows, true, st.OK
+}
+
+// Returns the row numbers which may pass the filter according to index of the column.
+// The second return value is false if there is no index to use, indexes have only the latest rows
+// thus they are not used to read a snapshot.
+func (r *Result) candidates(t *table.Table, columnName string, f filter.Filter, parameter interface{}) (map[int]bool, bool, int) {
+	idx := t.Index(columnName)
+	if idx == nil || r.Snapshot != nil {
+		return nil, false, st.OK
+	}
+	var rows []int
+	indexed := true
+	var status int
+	switch f := f.(type) {
+	case filter.Eq:
+		rows, indexed, status = lookup(t, idx, columnName, f.Mode.Or(filter.Text), []interface{}{parameter})
+	case filter.In:
+		rows, indexed, status = lookup(t, idx, columnName, f.Mode.Or(filter.Text), filter.List(parameter))
+	default:
+		low, high, isRange := keyRange(t, columnName, f, parameter)
+		if !isRange || idx.Type != column.Int && idx.Type != column.Float {
+			return nil, false, st.OK
+		}
+		rows, status = idx.Range(low, high)
+	}
+	if status != st.OK {
+		return nil, false, r.fail(st.From(status, idx.Err()).WithTable(t.Name).WithColumn(columnName))
+	}
+	if !indexed {
+		return nil, false, st.OK
+	}
+	result := make(map[int]bool)
+	for _, row := range rows {
+		result[row] = true
+	}
+	return result, true, st.OK
+}
+
 // Relational algebra select.
 func (r *Result) Select(alias string, filter filter.Filter, parameter interface{}) (*Result, int) {
 	tableName := r.Aliases[alias].TableName
@@ -32,18 +141,32 @@ func (r *Result) Select(alias string, filter filter.Filter, parameter interface{
 	table := r.Tables[tableName].Table
 	rowNumbers := r.Tables[tableName].RowNumbers
 	kept := make([]int, 0)
+	// Use index of the column to avoid reading rows which cannot pass the filter.
+	possible, indexed, status := r.candidates(table, columnName, filter, parameter)
+	if status != st.OK {
+		return r, status
+	}
 	// Iterate through the rows of the table of RA result.
 	for i := 0; i < len(rowNumbers); i++ {
-		row, status := table.Read(rowNumbers[i])
+		// Missing rows never pass the filter.
+		if rowNumbers[i] == NullRow || indexed && !possible[rowNumbers[i]] {
+			continue
+		}
+		row, status := r.read(table, rowNumbers[i])
 		if status != st.OK {
 			return r, status
 		}
 		// Keep the row if it passes the filter and is not a deleted row.
-		if row["~del"] != "y" && filter.Cmp(row[columnName], parameter) {
+		if r.visible(row) && filter.Cmp(row[columnName], parameter) {
 			kept = append(kept[:], i)
 		}
 	}
-	// Keep only the kept rows, for all existing tables of RA result.
+	r.keep(kept)
+	return r, st.OK
+}
+
+// Keep only the kept rows (positions in RA result), for all existing tables of RA result.
+func (r *Result) keep(kept []int) {
 	for _, table := range r.Tables {
 		newRowNumbers := make([]int, len(kept))
 		for i, keep := range kept {
@@ -51,6 +174,32 @@ func (r *Result) Select(alias string, filter filter.Filter, parameter interface{
 		}
 		table.RowNumbers = newRowNumbers
 	}
+}
+
+// Removes rows which are deleted in any table of RA result, or not seen by its snapshot.
+// (Load puts all rows of a table into RA result, including deleted rows)
+func (r *Result) ExcludeDeleted() (*Result, int) {
+	kept := make([]int, 0)
+	for i := 0; i < r.NumberOfRows(); i++ {
+		deleted := false
+		for _, table := range r.Tables {
+			if table.RowNumbers[i] == NullRow {
+				continue
+			}
+			row, status := r.read(table.Table, table.RowNumbers[i])
+			if status != st.OK {
+				return r, status
+			}
+			if !r.visible(row) {
+				deleted = true
+				break
+			}
+		}
+		if !deleted {
+			kept = append(kept[:], i)
+		}
+	}
+	r.keep(kept)
 	return r, st.OK
 }
 
@@ -61,13 +210,12 @@ type Condition struct {
 	Parameter interface{}   // parameter to feed the filter function
 }
 
-// Same as relational algebra select but takes multiple conditions and run them one-by-one.
+// Same as relational algebra select but takes multiple conditions, all of them must be true.
+// The conditions are tested in one pass over the rows.
 func (r *Result) MultipleSelect(conditions ...Condition) (*Result, int) {
-	for _, condition := range conditions {
-		_, status := r.Select(condition.Alias, condition.Filter, condition.Parameter)
-		if status != st.OK {
-			return r, status
-		}
+	and := make(And, len(conditions))
+	for i, condition := range conditions {
+		and[i] = Cmp{condition.Alias, condition.Filter, condition.Parameter}
 	}
-	return r, st.OK
+	return r.Where(and)
 }
@@ -0,0 +1,389 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/*
+Relational algebra sort.
+Rows are sorted in memory if their sort keys fit in the memory budget, otherwise sorted
+runs of rows are written into temporary files in database directory (or system's temporary directory)
+and then merged. At most SortMergeWidth runs are open at a time, once there are as many they are
+merged into one run.
+*/
+
+package ra
+
+import (
+	"bufio"
+	"container/heap"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"constant"
+	"logg"
+	"st"
+)
+
+// Sort rows by the value of an alias.
+type SortKey struct {
+	Alias      string
+	Descending bool
+	Numeric    bool // compare values as numbers, values which are not numbers come first
+}
+
+// Position of a row in RA result and the row's values of sort keys.
+type sortItem struct {
+	position int
+	values   []string
+}
+
+// Compares two strings, returns -1, 0 or 1.
+func compareStrings(a, b string) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Compares two values of a sort key, returns -1, 0 or 1.
+func compareValues(key SortKey, a, b string) int {
+	result := 0
+	if key.Numeric {
+		aNumber, aErr := strconv.Atof64(a)
+		bNumber, bErr := strconv.Atof64(b)
+		switch {
+		case aErr != nil && bErr == nil:
+			result = -1
+		case aErr == nil && bErr != nil:
+			result = 1
+		case aErr == nil && bErr == nil && aNumber < bNumber:
+			result = -1
+		case aErr == nil && bErr == nil && aNumber > bNumber:
+			result = 1
+		case aErr != nil && bErr != nil:
+			result = compareStrings(a, b)
+		}
+	} else {
+		result = compareStrings(a, b)
+	}
+	if key.Descending {
+		return -result
+	}
+	return result
+}
+
+// Returns true if item a comes before item b. Rows having equal keys remain in their original order.
+func sortsBefore(keys []SortKey, a, b *sortItem) bool {
+	for i, key := range keys {
+		if result := compareValues(key, a.values[i], b.values[i]); result != 0 {
+			return result < 0
+		}
+	}
+	return a.position < b.position
+}
+
+// Items sorted in memory.
+type sortItems struct {
+	items []*sortItem
+	keys  []SortKey
+}
+
+func (s *sortItems) Len() int           { return len(s.items) }
+func (s *sortItems) Less(i, j int) bool { return sortsBefore(s.keys, s.items[i], s.items[j]) }
+func (s *sortItems) Swap(i, j int)      { s.items[i], s.items[j] = s.items[j], s.items[i] }
+
+// A sorted run of items in a temporary file.
+type sortRun struct {
+	file   *os.File
+	reader *bufio.Reader
+	item   *sortItem // the next item of the run, nil if the run is exhausted
+}
+
+// Creates an empty run in a temporary file in the directory, returns the run and the writer of its file.
+func createRun(dir string) (*sortRun, *bufio.Writer, *st.Error) {
+	file, err := ioutil.TempFile(dir, constant.SortFilePrefix)
+	if err != nil {
+		logg.Err("ra", "createRun", err.String())
+		return nil, nil, st.Wrap(st.CannotWriteSortFile, err)
+	}
+	return &sortRun{file: file}, bufio.NewWriter(file), nil
+}
+
+// Writes an item into a run, one item per line.
+// Values are quoted, thus they never contain the tab which separates them.
+func writeItem(writer *bufio.Writer, item *sortItem) os.Error {
+	line := strconv.Itoa(item.position)
+	for _, value := range item.values {
+		line += "\t" + strconv.Quote(value)
+	}
+	_, err := writer.WriteString(line + "\n")
+	return err
+}
+
+// Ends writing a run (err is the error of writing it) and reads its first item.
+// The run is removed if it cannot be written or read.
+func (run *sortRun) rewind(writer *bufio.Writer, err os.Error) *st.Error {
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		_, err = run.file.Seek(0, 0)
+	}
+	if err != nil {
+		logg.Err("ra", "rewind", err.String())
+		run.remove()
+		return st.Wrap(st.CannotWriteSortFile, err)
+	}
+	run.reader = bufio.NewReader(run.file)
+	if e := run.next(); e != nil {
+		run.remove()
+		return e
+	}
+	return nil
+}
+
+// Writes sorted items into a temporary file in the directory.
+func writeRun(dir string, items []*sortItem) (*sortRun, *st.Error) {
+	run, writer, e := createRun(dir)
+	if e != nil {
+		return nil, e
+	}
+	var err os.Error
+	for _, item := range items {
+		if err = writeItem(writer, item); err != nil {
+			break
+		}
+	}
+	if e := run.rewind(writer, err); e != nil {
+		return nil, e
+	}
+	return run, nil
+}
+
+// Reads the next item of the run.
+func (run *sortRun) next() *st.Error {
+	line, err := run.reader.ReadString('\n')
+	if err == os.EOF && line == "" {
+		run.item = nil
+		return nil
+	}
+	if err != nil {
+		logg.Err("ra", "next", err.String())
+		return st.Wrap(st.CannotReadSortFile, err)
+	}
+	fields := strings.Split(strings.TrimRight(line, "\n"), "\t")
+	position, err := strconv.Atoi(fields[0])
+	if err != nil {
+		logg.Err("ra", "next", err.String())
+		return st.Wrap(st.CannotReadSortFile, err)
+	}
+	run.item = &sortItem{position, make([]string, len(fields)-1)}
+	for i, field := range fields[1:] {
+		run.item.values[i], err = strconv.Unquote(field)
+		if err != nil {
+			logg.Err("ra", "next", err.String())
+			return st.Wrap(st.CannotReadSortFile, err)
+		}
+	}
+	return nil
+}
+
+// Closes and removes the temporary file of the run.
+func (run *sortRun) remove() {
+	run.file.Close()
+	err := os.Remove(run.file.Name())
+	if err != nil {
+		logg.Warn("ra", "remove", err.String())
+	}
+}
+
+// Runs ordered by their next items, used for merging.
+type sortRuns struct {
+	runs []*sortRun
+	keys []SortKey
+}
+
+func (s *sortRuns) Len() int { return len(s.runs) }
+func (s *sortRuns) Less(i, j int) bool {
+	return sortsBefore(s.keys, s.runs[i].item, s.runs[j].item)
+}
+func (s *sortRuns) Swap(i, j int)      { s.runs[i], s.runs[j] = s.runs[j], s.runs[i] }
+func (s *sortRuns) Push(x interface{}) { s.runs = append(s.runs, x.(*sortRun)) }
+func (s *sortRuns) Pop() (x interface{}) {
+	x = s.runs[len(s.runs)-1]
+	s.runs = s.runs[:len(s.runs)-1]
+	return
+}
+
+// Merges sorted runs, passes all items in order to the function.
+func merge(keys []SortKey, runs []*sortRun, f func(item *sortItem) *st.Error) *st.Error {
+	pending := &sortRuns{make([]*sortRun, 0), keys}
+	for _, run := range runs {
+		if run.item != nil {
+			pending.runs = append(pending.runs, run)
+		}
+	}
+	heap.Init(pending)
+	for pending.Len() > 0 {
+		run := heap.Pop(pending).(*sortRun)
+		if e := f(run.item); e != nil {
+			return e
+		}
+		if e := run.next(); e != nil {
+			return e
+		}
+		if run.item != nil {
+			heap.Push(pending, run)
+		}
+	}
+	return nil
+}
+
+// Merges sorted runs into a new run in a temporary file in the directory, the merged runs are removed.
+func mergeRuns(dir string, keys []SortKey, runs []*sortRun) (*sortRun, *st.Error) {
+	merged, writer, e := createRun(dir)
+	if e != nil {
+		return nil, e
+	}
+	var err os.Error
+	e = merge(keys, runs, func(item *sortItem) *st.Error {
+		if err = writeItem(writer, item); err != nil {
+			return st.Wrap(st.CannotWriteSortFile, err)
+		}
+		return nil
+	})
+	if e != nil {
+		merged.remove()
+		return nil, e
+	}
+	if e := merged.rewind(writer, nil); e != nil {
+		return nil, e
+	}
+	for _, run := range runs {
+		run.remove()
+	}
+	return merged, nil
+}
+
+// Returns the approximate memory used by an item.
+func itemSize(item *sortItem) int {
+	size := 64
+	for _, value := range item.values {
+		size += len(value) + 16
+	}
+	return size
+}
+
+// Relational algebra sort. Rows are sorted by the first key, then by the second key if the first
+// keys are equal, and so on. Rows having equal keys remain in their original order.
+func (r *Result) Sort(keys ...SortKey) (*Result, int) {
+	for _, key := range keys {
+		if _, exists := r.Aliases[key.Alias]; !exists {
+			return r, r.fail(st.New(st.AliasNotFound).WithColumn(key.Alias))
+		}
+	}
+	// Temporary files are created in the directory of tables (database directory), or in the system's
+	// temporary directory if the tables' directory is gone (e.g. temporary tables made by group by).
+	dir := ""
+	for _, t := range r.Tables {
+		if fi, err := os.Stat(t.Table.Path); err == nil && fi.IsDirectory() {
+			dir = t.Table.Path
+		}
+	}
+	budget := r.SortMemory
+	if budget <= 0 {
+		budget = constant.SortMemoryBudget
+	}
+	items := make([]*sortItem, 0)
+	runs := make([]*sortRun, 0)
+	defer func() {
+		for _, run := range runs {
+			run.remove()
+		}
+	}()
+	// Adds a run, the runs are merged into one if there are too many open.
+	addRun := func(run *sortRun) *st.Error {
+		runs = append(runs, run)
+		if len(runs) < constant.SortMergeWidth {
+			return nil
+		}
+		merged, e := mergeRuns(dir, keys, runs)
+		if e != nil {
+			return e
+		}
+		runs = []*sortRun{merged}
+		return nil
+	}
+	size := 0
+	for i := 0; i < r.NumberOfRows(); i++ {
+		row, status := r.ReadAliases(i)
+		if status != st.OK {
+			return r, status
+		}
+		item := &sortItem{i, make([]string, len(keys))}
+		for j, key := range keys {
+			item.values[j] = row[key.Alias]
+		}
+		items = append(items, item)
+		size += itemSize(item)
+		// Sort the items in memory and write them into a run, once the memory budget is used up.
+		if size > budget {
+			sort.Sort(&sortItems{items, keys})
+			run, e := writeRun(dir, items)
+			if e == nil {
+				e = addRun(run)
+			}
+			if e != nil {
+				return r, r.fail(e)
+			}
+			items = make([]*sortItem, 0)
+			size = 0
+		}
+	}
+	sort.Sort(&sortItems{items, keys})
+	var positions []int
+	if len(runs) == 0 {
+		positions = make([]int, len(items))
+		for i, item := range items {
+			positions[i] = item.position
+		}
+	} else {
+		if len(items) > 0 {
+			run, e := writeRun(dir, items)
+			if e == nil {
+				e = addRun(run)
+			}
+			if e != nil {
+				return r, r.fail(e)
+			}
+		}
+		positions = make([]int, 0)
+		e := merge(keys, runs, func(item *sortItem) *st.Error {
+			positions = append(positions, item.position)
+			return nil
+		})
+		if e != nil {
+			return r, r.fail(e)
+		}
+	}
+	r.keep(positions)
+	return r, st.OK
+}
@@ -0,0 +1,88 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package ra
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"constant"
+	"st"
+)
+
+var sortTests = []struct {
+	keys  []SortKey
+	names []string
+}{
+	// Values which are not numbers come first.
+	{[]SortKey{{"AGE", false, true}}, []string{"ANN", "NIKKI", "BUZZ", "CHRISTINA", "JOSHUA"}},
+	{[]SortKey{{"AGE", false, false}}, []string{"ANN", "BUZZ", "CHRISTINA", "JOSHUA", "NIKKI"}},
+	// Rows having equal keys remain in their original order.
+	{[]SortKey{{"AGE", true, true}}, []string{"JOSHUA", "BUZZ", "CHRISTINA", "NIKKI", "ANN"}},
+	{[]SortKey{{"AGE", false, true}, {"NAME", true, false}}, []string{"ANN", "NIKKI", "CHRISTINA", "BUZZ", "JOSHUA"}},
+}
+
+func TestSort(t *testing.T) {
+	person := testTable(t, "PERSON", []string{"NAME", "AGE"}, []string{"BUZZ", "18"}, []string{"NIKKI", "9"},
+		[]string{"JOSHUA", "30"}, []string{"CHRISTINA", "18"}, []string{"ANN", ""})
+	for _, test := range sortTests {
+		// In memory, and in temporary files of one row each.
+		for _, memory := range []int{0, 1} {
+			r := New()
+			r.Load(person)
+			r.SortMemory = memory
+			if _, status := r.Sort(test.keys...); status != st.OK {
+				t.Errorf("Sort(%v) in memory %d returned %s", test.keys, memory, r.Err())
+				continue
+			}
+			names := testRows(t, r, "NAME")
+			if fmt.Sprint(names) != fmt.Sprint(test.names) {
+				t.Errorf("Sort(%v) in memory %d: %v, want %v", test.keys, memory, names, test.names)
+			}
+		}
+	}
+}
+
+// Sorts more runs than are merged at a time.
+func TestSortManyRuns(t *testing.T) {
+	rows := make([][]string, 3*constant.SortMergeWidth+1)
+	for i := range rows {
+		rows[i] = []string{strconv.Itoa(i), strconv.Itoa(i * 37 % 100)}
+	}
+	numbers := testTable(t, "NUMBERS", []string{"POSITION", "VALUE"}, rows...)
+	r := New()
+	r.Load(numbers)
+	r.SortMemory = 1
+	if _, status := r.Sort(SortKey{"VALUE", false, true}); status != st.OK {
+		t.Fatal(r.Err())
+	}
+	sorted := testRows(t, r, "VALUE", "POSITION")
+	if len(sorted) != len(rows) {
+		t.Fatalf("%d rows after sort, want %d", len(sorted), len(rows))
+	}
+	lastValue, lastPosition := -1, -1
+	for _, row := range sorted {
+		var value, position int
+		fmt.Sscanf(row, "%d/%d", &value, &position)
+		if value < lastValue || value == lastValue && position < lastPosition {
+			t.Fatalf("rows are not in order: %v", sorted)
+		}
+		lastValue, lastPosition = value, position
+	}
+}
@@ -0,0 +1,74 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/* Temporary tables holding rows computed by relational algebras (e.g. group by). */
+
+package ra
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"column"
+	"constant"
+	"table"
+	"tablefilemanager"
+	"logg"
+	"st"
+)
+
+// Creates an empty temporary table with the columns, outside of any database.
+// Files of the table are removed once the table is opened, the table is closed when garbage collected.
+// Returns nil error if the table is created, otherwise the error wrapping the OS error.
+func temporaryTable(name string, columns []*column.Column) (*table.Table, *st.Error) {
+	dir, err := ioutil.TempDir("", constant.TemporaryDirPrefix)
+	if err != nil {
+		logg.Err("ra", "temporaryTable", err.String())
+		return nil, st.Wrap(st.CannotCreateTemporaryTable, err).WithTable(name)
+	}
+	dir += "/"
+	defer os.RemoveAll(dir)
+	if e := tablefilemanager.Create(dir, name); e != nil {
+		return nil, e
+	}
+	t, status := table.Open(dir, name)
+	if status != st.OK {
+		return nil, st.From(status, t.Err()).WithTable(name)
+	}
+	runtime.SetFinalizer(t, (*table.Table).Close)
+	for columnName, length := range constant.DatabaseColumns() {
+		status = t.Add(columnName, length)
+		if status != st.OK {
+			return nil, st.From(status, t.Err())
+		}
+	}
+	for _, c := range columns {
+		status = t.AddTyped(c.Name, c.Length, c.Type)
+		if status != st.OK {
+			return nil, st.From(status, t.Err())
+		}
+	}
+	return t, nil
+}
+
+// Returns a new RA result having all rows of the table.
+func resultOf(t *table.Table) (*Result, int) {
+	r := New()
+	_, status := r.Load(t)
+	return r, status
+}
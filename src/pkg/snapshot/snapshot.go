@@ -0,0 +1,141 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/*
+Snapshots of multi-version tables.
+
+A row of a multi-version table is a version, which carries the ID of the transaction creating it in
+column ~creator, and the ID of the transaction deleting or replacing it in column ~deleter. An update
+marks the old version deleted and inserts the new version, old versions stay in the table until they
+are garbage collected. Tables keep multiple versions once they are made to (see table.AddVersions),
+rows of other tables are seen as they are, including changes which are not committed.
+
+A snapshot sees the versions created by transactions which had finished writing when the snapshot was
+taken, unless such a transaction deleted them. Readers of a snapshot see a consistent state of tables
+without locking them, and writers are not blocked by them.
+
+Versions without creator (written outside of transactions, or by earlier versions) are seen by all
+snapshots. A version marked deleted (~del) without deleter is seen by none, e.g. a row inserted by a
+transaction which rolled back.
+
+Snapshots know the transactions of this process only. While other processes hold the database, their
+changes are seen as soon as they are written; use shared locks to read them consistently.
+*/
+
+package snapshot
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Snapshot struct {
+	ID     int64          // versions of transactions beginning to write after the snapshot is taken are not seen
+	Active map[int64]bool // transactions writing when the snapshot was taken
+	Owner  int64          // the transaction whose own versions are seen, 0 if none
+}
+
+var (
+	mutex     sync.Mutex
+	last      int64                      // the latest ID
+	writing   = make(map[int64]bool)     // transactions writing versions
+	snapshots = make(map[*Snapshot]bool) // snapshots in use
+)
+
+// Returns a new ID, greater than the IDs returned before.
+func next() int64 {
+	id := time.Nanoseconds()
+	if id <= last {
+		id = last + 1
+	}
+	last = id
+	return id
+}
+
+// Registers a transaction which is about to write versions, returns the ID which its versions carry.
+func Begin() int64 {
+	mutex.Lock()
+	defer mutex.Unlock()
+	id := next()
+	writing[id] = true
+	return id
+}
+
+// Ends a writing transaction, the versions it left are seen by snapshots taken afterwards.
+// A transaction rolling back must have undone its versions before it ends.
+func End(id int64) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	writing[id] = false, false
+}
+
+// Takes a snapshot which sees the versions of committed transactions and of the owner transaction
+// (0 if none). The snapshot must be released after use.
+func Take(owner int64) *Snapshot {
+	mutex.Lock()
+	defer mutex.Unlock()
+	s := &Snapshot{next(), make(map[int64]bool), owner}
+	for id, _ := range writing {
+		if id != owner {
+			s.Active[id] = true
+		}
+	}
+	snapshots[s] = true
+	return s
+}
+
+// Releases the snapshot, versions which only it sees may be garbage collected.
+func (s *Snapshot) Release() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	snapshots[s] = false, false
+}
+
+// Returns true if the snapshot sees the versions written by a transaction (a version's ~creator or ~deleter).
+func (s *Snapshot) sees(transactionID string) bool {
+	if transactionID == "" {
+		return true
+	}
+	id, err := strconv.Atoi64(transactionID)
+	if err != nil {
+		return true
+	}
+	if id == s.Owner {
+		return true
+	}
+	return id < s.ID && !s.Active[id]
+}
+
+// Returns true if the snapshot sees a row (version).
+func (s *Snapshot) Visible(row map[string]string) bool {
+	deleter := row["~deleter"]
+	if row["~del"] == "y" && deleter == "" {
+		return false
+	}
+	return s.sees(row["~creator"]) && (deleter == "" || !s.sees(deleter))
+}
+
+// Returns true if no transaction is writing and no snapshot is in use. Deleted rows and old versions
+// may then be garbage collected, no one in this process holds their row numbers (in undo records,
+// row locks or results read from snapshots).
+func Idle() bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return len(writing) == 0 && len(snapshots) == 0
+}
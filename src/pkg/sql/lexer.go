@@ -0,0 +1,131 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/* Split SQL text into tokens. */
+
+package sql
+
+import (
+	"strings"
+)
+
+// Token kinds.
+const (
+	tokenEOF = iota
+	tokenKeyword
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenSymbol
+)
+
+// SQL keywords, identifiers matching them (case insensitive) are keywords.
+var keywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "AND": true, "JOIN": true, "INNER": true, "ON": true,
+	"INSERT": true, "INTO": true, "VALUES": true, "UPDATE": true, "SET": true, "DELETE": true,
+	"CREATE": true, "TABLE": true, "ALTER": true, "ADD": true, "DROP": true, "COLUMN": true,
+	"RENAME": true, "TO": true, "EXPLAIN": true, "WITH": true, "VERSIONS": true,
+}
+
+type token struct {
+	kind     int
+	text     string // keywords are in upper case, strings are unquoted
+	position int    // offset of the token in SQL text
+}
+
+// Returns true if the character may begin an identifier.
+func identStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// Returns true if the character is a decimal digit.
+func digit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// Splits SQL text into tokens, the last token is always EOF.
+// If there is an unexpected character, returns its offset and an error description.
+func lex(query string) ([]token, int, string) {
+	tokens := make([]token, 0)
+	i := 0
+	for i < len(query) {
+		c := query[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			// Comment till end of line.
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+			continue
+		case identStart(c):
+			for i < len(query) && (identStart(query[i]) || digit(query[i])) {
+				i++
+			}
+			word := query[start:i]
+			if keywords[strings.ToUpper(word)] {
+				tokens = append(tokens[:], token{tokenKeyword, strings.ToUpper(word), start})
+			} else {
+				tokens = append(tokens[:], token{tokenIdent, word, start})
+			}
+		case digit(c) || c == '-' && i+1 < len(query) && digit(query[i+1]):
+			i++
+			for i < len(query) && (digit(query[i]) || query[i] == '.') {
+				i++
+			}
+			tokens = append(tokens[:], token{tokenNumber, query[start:i], start})
+		case c == '\'':
+			// String literal, a quote inside is written as two quotes.
+			value := ""
+			i++
+			for {
+				if i >= len(query) {
+					return nil, start, "string is not terminated"
+				}
+				if query[i] == '\'' {
+					if i+1 < len(query) && query[i+1] == '\'' {
+						value += "'"
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				value += query[i : i+1]
+				i++
+			}
+			tokens = append(tokens[:], token{tokenString, value, start})
+		case c == '<' || c == '>' || c == '!':
+			i++
+			if i < len(query) && (query[i] == '=' || c == '<' && query[i] == '>') {
+				i++
+			}
+			tokens = append(tokens[:], token{tokenSymbol, query[start:i], start})
+		case strings.IndexRune("(),=*;.", int(c)) != -1:
+			i++
+			tokens = append(tokens[:], token{tokenSymbol, query[start:i], start})
+		default:
+			return nil, start, "unexpected character " + query[start:start+1]
+		}
+	}
+	tokens = append(tokens[:], token{tokenEOF, "", len(query)})
+	return tokens, 0, ""
+}
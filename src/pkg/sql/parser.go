@@ -0,0 +1,557 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/*
+Parse SQL statements.
+
+Supported statements are:
+SELECT * | column, ... FROM table [, table ...] [[INNER] JOIN table ON column = column ...] [WHERE condition [AND condition ...]]
+INSERT INTO table [(column, ...)] VALUES (value, ...)
+UPDATE table SET column = value [, column = value ...] [WHERE condition [AND condition ...]]
+DELETE FROM table [WHERE condition [AND condition ...]]
+CREATE TABLE table (column type[(length)], ...) [WITH VERSIONS]
+ALTER TABLE table ADD [COLUMN] column type[(length)]
+ALTER TABLE table DROP [COLUMN] column
+ALTER TABLE table RENAME TO table
+DROP TABLE table
+EXPLAIN SELECT ...
+
+A column may be qualified by table name (table.column). A condition compares a column with
+a value (string in single quotes, or number) or another column, using =, < or >.
+A table created WITH VERSIONS keeps multiple versions of rows (see package snapshot).
+*/
+
+package sql
+
+import (
+	"strconv"
+	"strings"
+	"column"
+	"constant"
+	"st"
+	"logg"
+)
+
+// Column types in CREATE/ALTER TABLE and their default lengths.
+var columnTypes = map[string]string{
+	"CHAR": column.String, "VARCHAR": column.String, "STRING": column.String,
+	"TEXT": column.Text, "INT": column.Int, "INTEGER": column.Int,
+	"FLOAT": column.Float, "REAL": column.Float, "DOUBLE": column.Float,
+	"BOOL": column.Bool, "BOOLEAN": column.Bool, "DATE": column.Date,
+	"BYTES": column.Bytes, "BLOB": column.Bytes,
+}
+var defaultLengths = map[string]int{
+	column.String: 50, column.Text: 255, column.Int: 20, column.Float: 30,
+	column.Bool: 5, column.Date: len(constant.DateFormat), column.Bytes: 100,
+}
+
+type Parser struct {
+	Query  string
+	Error  string // description of the syntax error, if parsing failed
+	tokens []token
+	next   int // index of the next token
+}
+
+// Returns a new parser of the SQL text.
+func NewParser(query string) *Parser {
+	return &Parser{Query: query}
+}
+
+// Parses SQL text which contains one statement.
+func Parse(query string) (Statement, int) {
+	return NewParser(query).Parse()
+}
+
+// Parses the SQL text, returns the statement.
+// If the text is malformed, Error describes the mistake.
+func (p *Parser) Parse() (Statement, int) {
+	var position int
+	var message string
+	p.tokens, position, message = lex(p.Query)
+	if p.tokens == nil {
+		return nil, p.failAt(position, message)
+	}
+	var statement Statement
+	var status int
+	switch {
+	case p.acceptKeyword("SELECT"):
+		statement, status = p.parseSelect()
+	case p.acceptKeyword("INSERT"):
+		statement, status = p.parseInsert()
+	case p.acceptKeyword("UPDATE"):
+		statement, status = p.parseUpdate()
+	case p.acceptKeyword("DELETE"):
+		statement, status = p.parseDelete()
+	case p.acceptKeyword("CREATE"):
+		statement, status = p.parseCreate()
+	case p.acceptKeyword("ALTER"):
+		statement, status = p.parseAlter()
+	case p.acceptKeyword("DROP"):
+		statement, status = p.parseDrop()
+	case p.acceptKeyword("EXPLAIN"):
+		statement, status = p.parseExplain()
+	default:
+		return nil, p.fail("a statement")
+	}
+	if status != st.OK {
+		return nil, status
+	}
+	// Optional semicolon ends the statement.
+	p.acceptSymbol(";")
+	if p.peek().kind != tokenEOF {
+		return nil, p.fail("end of statement")
+	}
+	return statement, st.OK
+}
+
+// Records a syntax error at an offset of SQL text.
+func (p *Parser) failAt(position int, message string) int {
+	line := strings.Count(p.Query[:position], "\n") + 1
+	offset := position - strings.LastIndex(p.Query[:position], "\n")
+	p.Error = "Syntax error at line " + strconv.Itoa(line) + " column " + strconv.Itoa(offset) + ": " + message
+	logg.Err("sql", "Parse", p.Error)
+	return st.SQLSyntaxError
+}
+
+// Returns the syntax error as an st.Error, or nil if there is none.
+func (p *Parser) Err() *st.Error {
+	if p.Error == "" {
+		return nil
+	}
+	e := st.New(st.SQLSyntaxError)
+	e.Message = p.Error
+	return e
+}
+
+// Records a syntax error at the next token.
+func (p *Parser) fail(expected string) int {
+	found := p.peek()
+	description := "end of statement"
+	switch found.kind {
+	case tokenString:
+		description = "'" + found.text + "'"
+	case tokenKeyword, tokenIdent, tokenNumber, tokenSymbol:
+		description = found.text
+	}
+	return p.failAt(found.position, "expected "+expected+" but found "+description)
+}
+
+// Returns the next token without consuming it.
+func (p *Parser) peek() token {
+	return p.tokens[p.next]
+}
+
+// Consumes the next token.
+func (p *Parser) advance() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEOF {
+		p.next++
+	}
+	return t
+}
+
+// Consumes the next token if it is the keyword.
+func (p *Parser) acceptKeyword(keyword string) bool {
+	if t := p.peek(); t.kind == tokenKeyword && t.text == keyword {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+// Consumes the next token if it is the symbol.
+func (p *Parser) acceptSymbol(symbol string) bool {
+	if t := p.peek(); t.kind == tokenSymbol && t.text == symbol {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+// Consumes the keyword or fails.
+func (p *Parser) expectKeyword(keyword string) int {
+	if !p.acceptKeyword(keyword) {
+		return p.fail(keyword)
+	}
+	return st.OK
+}
+
+// Consumes the symbol or fails.
+func (p *Parser) expectSymbol(symbol string) int {
+	if !p.acceptSymbol(symbol) {
+		return p.fail(symbol)
+	}
+	return st.OK
+}
+
+// Consumes an identifier (e.g. table name) or fails.
+func (p *Parser) expectIdent(what string) (string, int) {
+	if t := p.peek(); t.kind == tokenIdent {
+		p.advance()
+		return t.text, st.OK
+	}
+	return "", p.fail(what)
+}
+
+// Parses a column reference "column" or "table.column".
+func (p *Parser) parseColumnRef() (*ColumnRef, int) {
+	name, status := p.expectIdent("column name")
+	if status != st.OK {
+		return nil, status
+	}
+	if p.acceptSymbol(".") {
+		columnName, status := p.expectIdent("column name")
+		if status != st.OK {
+			return nil, status
+		}
+		return &ColumnRef{Table: name, Column: columnName}, st.OK
+	}
+	return &ColumnRef{Column: name}, st.OK
+}
+
+// Parses a value (string or number).
+func (p *Parser) parseValue() (string, int) {
+	if t := p.peek(); t.kind == tokenString || t.kind == tokenNumber {
+		p.advance()
+		return t.text, st.OK
+	}
+	return "", p.fail("a value")
+}
+
+// Parses a column reference or a value.
+func (p *Parser) parseOperand() (Operand, int) {
+	if p.peek().kind == tokenIdent {
+		ref, status := p.parseColumnRef()
+		return Operand{Column: ref}, status
+	}
+	value, status := p.parseValue()
+	return Operand{Value: value}, status
+}
+
+// Parses a comparison.
+func (p *Parser) parseComparison() (*Comparison, int) {
+	left, status := p.parseOperand()
+	if status != st.OK {
+		return nil, status
+	}
+	operator := p.peek()
+	if operator.kind != tokenSymbol || !comparisonOperator(operator.text) {
+		return nil, p.fail("a comparison operator")
+	}
+	p.advance()
+	right, status := p.parseOperand()
+	if status != st.OK {
+		return nil, status
+	}
+	return &Comparison{Left: left, Operator: operator.text, Right: right}, st.OK
+}
+
+// Parses optional WHERE clause.
+func (p *Parser) parseWhere() ([]*Comparison, int) {
+	conditions := make([]*Comparison, 0)
+	if !p.acceptKeyword("WHERE") {
+		return conditions, st.OK
+	}
+	for {
+		condition, status := p.parseComparison()
+		if status != st.OK {
+			return nil, status
+		}
+		conditions = append(conditions[:], condition)
+		if !p.acceptKeyword("AND") {
+			return conditions, st.OK
+		}
+	}
+	return conditions, st.OK
+}
+
+// Parses a column definition "column type[(length)]".
+func (p *Parser) parseColumnDef() (*ColumnDef, int) {
+	name, status := p.expectIdent("column name")
+	if status != st.OK {
+		return nil, status
+	}
+	typeToken := p.peek()
+	columnType, exists := columnTypes[strings.ToUpper(typeToken.text)]
+	if typeToken.kind != tokenIdent || !exists {
+		return nil, p.fail("a column type")
+	}
+	p.advance()
+	length := defaultLengths[columnType]
+	if p.acceptSymbol("(") {
+		lengthToken := p.peek()
+		if lengthToken.kind != tokenNumber {
+			return nil, p.fail("column length")
+		}
+		p.advance()
+		number, err := strconv.Atoi(lengthToken.text)
+		if err != nil || number <= 0 {
+			return nil, p.failAt(lengthToken.position, "invalid column length "+lengthToken.text)
+		}
+		length = number
+		if status = p.expectSymbol(")"); status != st.OK {
+			return nil, status
+		}
+	}
+	return &ColumnDef{Name: name, Type: columnType, Length: length}, st.OK
+}
+
+// SELECT ...
+func (p *Parser) parseSelect() (Statement, int) {
+	s := &Select{Columns: make([]*ColumnRef, 0), From: make([]string, 0)}
+	if !p.acceptSymbol("*") {
+		for {
+			ref, status := p.parseColumnRef()
+			if status != st.OK {
+				return nil, status
+			}
+			s.Columns = append(s.Columns[:], ref)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if status := p.expectKeyword("FROM"); status != st.OK {
+		return nil, status
+	}
+	joins := make([]*Comparison, 0)
+	for {
+		name, status := p.expectIdent("table name")
+		if status != st.OK {
+			return nil, status
+		}
+		s.From = append(s.From[:], name)
+		if p.acceptSymbol(",") {
+			continue
+		}
+		p.acceptKeyword("INNER")
+		if !p.acceptKeyword("JOIN") {
+			break
+		}
+		name, status = p.expectIdent("table name")
+		if status != st.OK {
+			return nil, status
+		}
+		s.From = append(s.From[:], name)
+		// JOIN ... ON condition is the same as a condition in WHERE clause.
+		if status = p.expectKeyword("ON"); status != st.OK {
+			return nil, status
+		}
+		on, status := p.parseComparison()
+		if status != st.OK {
+			return nil, status
+		}
+		joins = append(joins[:], on)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	where, status := p.parseWhere()
+	if status != st.OK {
+		return nil, status
+	}
+	s.Where = append(joins, where...)
+	return s, st.OK
+}
+
+// INSERT INTO ...
+func (p *Parser) parseInsert() (Statement, int) {
+	if status := p.expectKeyword("INTO"); status != st.OK {
+		return nil, status
+	}
+	name, status := p.expectIdent("table name")
+	if status != st.OK {
+		return nil, status
+	}
+	s := &Insert{Table: name, Columns: make([]string, 0), Values: make([]string, 0)}
+	if p.acceptSymbol("(") {
+		for {
+			columnName, status := p.expectIdent("column name")
+			if status != st.OK {
+				return nil, status
+			}
+			s.Columns = append(s.Columns[:], columnName)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if status = p.expectSymbol(")"); status != st.OK {
+			return nil, status
+		}
+	}
+	if status = p.expectKeyword("VALUES"); status != st.OK {
+		return nil, status
+	}
+	if status = p.expectSymbol("("); status != st.OK {
+		return nil, status
+	}
+	for {
+		value, status := p.parseValue()
+		if status != st.OK {
+			return nil, status
+		}
+		s.Values = append(s.Values[:], value)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if status = p.expectSymbol(")"); status != st.OK {
+		return nil, status
+	}
+	return s, st.OK
+}
+
+// UPDATE ...
+func (p *Parser) parseUpdate() (Statement, int) {
+	name, status := p.expectIdent("table name")
+	if status != st.OK {
+		return nil, status
+	}
+	if status = p.expectKeyword("SET"); status != st.OK {
+		return nil, status
+	}
+	s := &Update{Table: name, Set: make(map[string]string)}
+	for {
+		columnName, status := p.expectIdent("column name")
+		if status != st.OK {
+			return nil, status
+		}
+		if status = p.expectSymbol("="); status != st.OK {
+			return nil, status
+		}
+		s.Set[columnName], status = p.parseValue()
+		if status != st.OK {
+			return nil, status
+		}
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	s.Where, status = p.parseWhere()
+	if status != st.OK {
+		return nil, status
+	}
+	return s, st.OK
+}
+
+// DELETE FROM ...
+func (p *Parser) parseDelete() (Statement, int) {
+	if status := p.expectKeyword("FROM"); status != st.OK {
+		return nil, status
+	}
+	name, status := p.expectIdent("table name")
+	if status != st.OK {
+		return nil, status
+	}
+	s := &Delete{Table: name}
+	s.Where, status = p.parseWhere()
+	if status != st.OK {
+		return nil, status
+	}
+	return s, st.OK
+}
+
+// CREATE TABLE ...
+func (p *Parser) parseCreate() (Statement, int) {
+	if status := p.expectKeyword("TABLE"); status != st.OK {
+		return nil, status
+	}
+	name, status := p.expectIdent("table name")
+	if status != st.OK {
+		return nil, status
+	}
+	if status = p.expectSymbol("("); status != st.OK {
+		return nil, status
+	}
+	s := &CreateTable{Table: name, Columns: make([]*ColumnDef, 0)}
+	for {
+		def, status := p.parseColumnDef()
+		if status != st.OK {
+			return nil, status
+		}
+		s.Columns = append(s.Columns[:], def)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if status = p.expectSymbol(")"); status != st.OK {
+		return nil, status
+	}
+	if p.acceptKeyword("WITH") {
+		if status = p.expectKeyword("VERSIONS"); status != st.OK {
+			return nil, status
+		}
+		s.Versions = true
+	}
+	return s, st.OK
+}
+
+// ALTER TABLE ...
+func (p *Parser) parseAlter() (Statement, int) {
+	if status := p.expectKeyword("TABLE"); status != st.OK {
+		return nil, status
+	}
+	name, status := p.expectIdent("table name")
+	if status != st.OK {
+		return nil, status
+	}
+	s := &AlterTable{Table: name}
+	switch {
+	case p.acceptKeyword("ADD"):
+		p.acceptKeyword("COLUMN")
+		s.Add, status = p.parseColumnDef()
+	case p.acceptKeyword("DROP"):
+		p.acceptKeyword("COLUMN")
+		s.Drop, status = p.expectIdent("column name")
+	case p.acceptKeyword("RENAME"):
+		if status = p.expectKeyword("TO"); status != st.OK {
+			return nil, status
+		}
+		s.RenameTo, status = p.expectIdent("table name")
+	default:
+		return nil, p.fail("ADD, DROP or RENAME")
+	}
+	if status != st.OK {
+		return nil, status
+	}
+	return s, st.OK
+}
+
+// DROP TABLE ...
+func (p *Parser) parseDrop() (Statement, int) {
+	if status := p.expectKeyword("TABLE"); status != st.OK {
+		return nil, status
+	}
+	name, status := p.expectIdent("table name")
+	if status != st.OK {
+		return nil, status
+	}
+	return &DropTable{Table: name}, st.OK
+}
+
+// EXPLAIN SELECT ...
+func (p *Parser) parseExplain() (Statement, int) {
+	if status := p.expectKeyword("SELECT"); status != st.OK {
+		return nil, status
+	}
+	statement, status := p.parseSelect()
+	if status != st.OK {
+		return nil, status
+	}
+	return &Explain{Select: statement.(*Select)}, st.OK
+}
@@ -0,0 +1,598 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/* Parsed SQL statements and their execution plans. */
+
+package sql
+
+import (
+	"strings"
+	"database"
+	"transaction"
+	"table"
+	"ra"
+	"plan"
+	"filter"
+	"snapshot"
+	"st"
+)
+
+// Outcome of executing a statement.
+type Output struct {
+	Result   *ra.Result // selected rows, only for SELECT
+	Columns  []string   // aliases of the selected columns in RA result, in the order they are selected
+	Affected int        // number of rows inserted, updated or deleted
+	Plan     string     // description of the executed plan, only for EXPLAIN
+}
+
+// A parsed SQL statement.
+// Statements which change table rows run in the transaction, or in a new transaction
+// which commits afterwards if the transaction is nil. UPDATE and DELETE lock the matching rows
+// exclusively, other rows of the table may be changed by other transactions meanwhile; ALTER TABLE
+// locks the table exclusively. SELECT in a transaction locks the tables
+// in shared mode, without a transaction it reads a snapshot of committed rows of multi-version tables
+// (see package snapshot).
+type Statement interface {
+	Execute(db *database.Database, tr *transaction.Transaction) (*Output, int)
+}
+
+// Reference to a column, table name is optional.
+type ColumnRef struct {
+	Table, Column string
+}
+
+// Either a column or a value.
+type Operand struct {
+	Column *ColumnRef // nil if the operand is a value
+	Value  string
+}
+
+type Comparison struct {
+	Left     Operand
+	Operator string
+	Right    Operand
+}
+
+type ColumnDef struct {
+	Name, Type string
+	Length     int
+}
+
+type Select struct {
+	Columns []*ColumnRef // empty if all columns are selected
+	From    []string     // tables in the order they are joined
+	Where   []*Comparison
+}
+
+// Executes the select and describes its plan.
+type Explain struct {
+	Select *Select
+}
+
+type Insert struct {
+	Table   string
+	Columns []string // empty if values are given for all columns
+	Values  []string
+}
+
+type Update struct {
+	Table string
+	Set   map[string]string
+	Where []*Comparison
+}
+
+type Delete struct {
+	Table string
+	Where []*Comparison
+}
+
+type CreateTable struct {
+	Table    string
+	Columns  []*ColumnDef
+	Versions bool // the table keeps multiple versions of rows
+}
+
+type AlterTable struct {
+	Table    string
+	Add      *ColumnDef // column to add
+	Drop     string     // column to remove
+	RenameTo string     // new table name
+}
+
+type DropTable struct {
+	Table string
+}
+
+// Returns true if the symbol is a supported comparison operator.
+func comparisonOperator(symbol string) bool {
+	_, exists := filters()[symbol]
+	return exists
+}
+
+// Returns comparison operators and their filters.
+func filters() map[string]filter.Filter {
+	return map[string]filter.Filter{"=": filter.Eq{}, "<>": filter.Ne{}, "!=": filter.Ne{},
+		"<": filter.Lt{}, "<=": filter.Le{}, ">": filter.Gt{}, ">=": filter.Ge{}}
+}
+
+// Returns the operator which gives the same result when operands are swapped.
+func swapped(operator string) string {
+	switch operator {
+	case "<":
+		return ">"
+	case ">":
+		return "<"
+	case "<=":
+		return ">="
+	case ">=":
+		return "<="
+	}
+	return operator
+}
+
+// Returns the RA result alias of a column, which is either the column name or qualified as "table.column".
+func resolve(r *ra.Result, ref *ColumnRef) (string, int) {
+	if ref.Table != "" {
+		alias := ref.Table + "." + ref.Column
+		if _, exists := r.Aliases[alias]; !exists {
+			return "", st.ColumnNameNotFound
+		}
+		return alias, st.OK
+	}
+	found := ""
+	for alias, tableColumn := range r.Aliases {
+		if tableColumn.ColumnName == ref.Column {
+			if found != "" {
+				return "", st.AmbiguousColumnName
+			}
+			found = alias
+		}
+	}
+	if found == "" {
+		return "", st.ColumnNameNotFound
+	}
+	return found, st.OK
+}
+
+// Returns the qualified alias ("table.column") of a column among the tables.
+func qualified(tables []*table.Table, ref *ColumnRef) (string, int) {
+	found := ""
+	for _, t := range tables {
+		if ref.Table != "" && ref.Table != t.Name {
+			continue
+		}
+		if _, exists := t.Columns[ref.Column]; exists {
+			if found != "" {
+				return "", st.AmbiguousColumnName
+			}
+			found = t.Name + "." + ref.Column
+		}
+	}
+	if found == "" {
+		return "", st.ColumnNameNotFound
+	}
+	return found, st.OK
+}
+
+// Converts a condition into a predicate on qualified aliases of the tables.
+func predicate(tables []*table.Table, c *Comparison) (ra.Predicate, int) {
+	switch {
+	case c.Left.Column != nil && c.Right.Column != nil:
+		left, status := qualified(tables, c.Left.Column)
+		if status != st.OK {
+			return nil, status
+		}
+		right, status := qualified(tables, c.Right.Column)
+		if status != st.OK {
+			return nil, status
+		}
+		return ra.CmpAlias{left, filters()[c.Operator], right}, st.OK
+	case c.Left.Column != nil:
+		alias, status := qualified(tables, c.Left.Column)
+		if status != st.OK {
+			return nil, status
+		}
+		return ra.Cmp{alias, filters()[c.Operator], c.Right.Value}, st.OK
+	case c.Right.Column != nil:
+		alias, status := qualified(tables, c.Right.Column)
+		if status != st.OK {
+			return nil, status
+		}
+		return ra.Cmp{alias, filters()[swapped(c.Operator)], c.Left.Value}, st.OK
+	}
+	// Comparing two values.
+	return nil, st.UnsupportedCondition
+}
+
+// Keeps rows passing the conditions (which compare a column with a value) in RA result.
+func where(r *ra.Result, conditions []*Comparison) int {
+	for _, c := range conditions {
+		if c == nil {
+			continue
+		}
+		ref, value, operator := c.Left.Column, c.Right.Value, c.Operator
+		if ref == nil {
+			ref, value, operator = c.Right.Column, c.Left.Value, swapped(c.Operator)
+		}
+		if ref == nil || c.Left.Column != nil && c.Right.Column != nil {
+			// Comparing two values, or two columns which are not join columns.
+			return st.UnsupportedCondition
+		}
+		alias, status := resolve(r, ref)
+		if status != st.OK {
+			return status
+		}
+		_, status = r.Select(alias, filters()[operator], value)
+		if status != st.OK {
+			return status
+		}
+	}
+	_, status := r.ExcludeDeleted()
+	return status
+}
+
+// Makes the optimized query plan of the statement.
+// Returns the plan and the qualified aliases of the selected columns in their order.
+func (s *Select) Plan(db *database.Database) (plan.Node, []string, int) {
+	tables := make([]*table.Table, 0)
+	for _, name := range s.From {
+		t, status := db.Get(name)
+		if status != st.OK {
+			return nil, nil, status
+		}
+		for _, existing := range tables {
+			if existing.Name == name {
+				return nil, nil, st.TableAlreadyExists
+			}
+		}
+		tables = append(tables, t)
+	}
+	predicates := make([]ra.Predicate, 0)
+	for _, c := range s.Where {
+		p, status := predicate(tables, c)
+		if status != st.OK {
+			return nil, nil, status
+		}
+		predicates = append(predicates, p)
+	}
+	// Join the tables in their order, each table is joined using a condition which compares its column
+	// with a column of the joined tables. The optimizer may choose a better order.
+	var node plan.Node = plan.NewScan(tables[0])
+	joined := map[string]bool{tables[0].Name: true}
+	for _, t := range tables[1:] {
+		found := false
+		for i, p := range predicates {
+			cmp, isCmp := p.(ra.CmpAlias)
+			if _, isEq := cmp.Filter.(filter.Eq); !isCmp || !isEq {
+				continue
+			}
+			left, right := cmp.Alias, cmp.Other
+			if strings.HasPrefix(left, t.Name+".") {
+				left, right = right, left
+			}
+			if joined[left[:strings.Index(left, ".")]] && strings.HasPrefix(right, t.Name+".") {
+				node = &plan.Join{Input: node, Right: plan.NewScan(t), Alias: left, Column: right[len(t.Name)+1:]}
+				predicates = append(predicates[:i], predicates[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, nil, st.MissingJoinCondition
+		}
+		joined[t.Name] = true
+	}
+	if len(predicates) > 0 {
+		node = &plan.Select{Input: node, Predicate: ra.And(predicates)}
+	}
+	// Work out the selected aliases.
+	aliases := make([]string, 0)
+	if len(s.Columns) == 0 {
+		for _, t := range tables {
+			for _, c := range t.ColumnsInOrder {
+				if !strings.HasPrefix(c.Name, "~") {
+					aliases = append(aliases, t.Name+"."+c.Name)
+				}
+			}
+		}
+	}
+	for _, ref := range s.Columns {
+		alias, status := qualified(tables, ref)
+		if status != st.OK {
+			return nil, nil, status
+		}
+		aliases = append(aliases, alias)
+	}
+	node, status := plan.Optimize(&plan.Project{Input: node, Aliases: aliases})
+	if status != st.OK {
+		return nil, nil, status
+	}
+	return node, aliases, st.OK
+}
+
+// Locks the tables of a plan for reading in the transaction, or makes the scans read a snapshot
+// if there is no transaction. Returns a function to be called after reading.
+func readIn(node plan.Node, tr *transaction.Transaction) (func(), int) {
+	if tr != nil {
+		for _, t := range node.Tables() {
+			status := tr.ReadLock(t)
+			if status != st.OK {
+				return nil, status
+			}
+		}
+		return func() {}, st.OK
+	}
+	s := snapshot.Take(0)
+	plan.InSnapshot(node, s)
+	return func() { s.Release() }, st.OK
+}
+
+func (s *Select) Execute(db *database.Database, tr *transaction.Transaction) (*Output, int) {
+	node, aliases, status := s.Plan(db)
+	if status != st.OK {
+		return nil, status
+	}
+	done, status := readIn(node, tr)
+	if status != st.OK {
+		return nil, status
+	}
+	defer done()
+	r, status := node.Execute()
+	if status != st.OK {
+		return nil, status
+	}
+	return &Output{Result: r, Columns: named(r, aliases)}, st.OK
+}
+
+func (s *Explain) Execute(db *database.Database, tr *transaction.Transaction) (*Output, int) {
+	node, aliases, status := s.Select.Plan(db)
+	if status != st.OK {
+		return nil, status
+	}
+	done, status := readIn(node, tr)
+	if status != st.OK {
+		return nil, status
+	}
+	defer done()
+	r, description, status := plan.Explain(node)
+	if status != st.OK {
+		return nil, status
+	}
+	return &Output{Result: r, Columns: named(r, aliases), Plan: description}, st.OK
+}
+
+// Names selected columns without table name unless the name is ambiguous, returns the new aliases.
+func named(r *ra.Result, aliases []string) []string {
+	columns := make(map[string]int)
+	for _, alias := range aliases {
+		columns[r.Aliases[alias].ColumnName]++
+	}
+	for i, alias := range aliases {
+		columnName := r.Aliases[alias].ColumnName
+		if columns[columnName] == 1 {
+			if _, status := r.Redefine(alias, columnName); status == st.OK {
+				aliases[i] = columnName
+			}
+		}
+	}
+	return aliases
+}
+
+// Runs a function in the transaction, or in a new transaction if it is nil.
+func inTransaction(db *database.Database, tr *transaction.Transaction, f func(*transaction.Transaction) (int, int)) (*Output, int) {
+	own := tr == nil
+	if own {
+		tr = transaction.New(db)
+	}
+	affected, status := f(tr)
+	if own {
+		if status == st.OK {
+			status = tr.Commit()
+		} else {
+			tr.Rollback()
+		}
+	}
+	if status != st.OK {
+		return nil, status
+	}
+	return &Output{Affected: affected}, st.OK
+}
+
+// Locks the rows of a table which pass the conditions exclusively, returns the numbers of the locked rows
+// which still pass the conditions (a row may change before it is locked).
+func lockMatching(tr *transaction.Transaction, t *table.Table, conditions []*Comparison) ([]int, int) {
+	rowNumbers, status := matching(t, conditions)
+	if status != st.OK {
+		return nil, status
+	}
+	locked := make(map[int]bool)
+	for _, rowNumber := range rowNumbers {
+		status = tr.ELockRow(t, rowNumber)
+		if status != st.OK {
+			return nil, status
+		}
+		locked[rowNumber] = true
+	}
+	rowNumbers, status = matching(t, conditions)
+	if status != st.OK {
+		return nil, status
+	}
+	stillMatching := make([]int, 0, len(rowNumbers))
+	for _, rowNumber := range rowNumbers {
+		if locked[rowNumber] {
+			stillMatching = append(stillMatching, rowNumber)
+		}
+	}
+	return stillMatching, st.OK
+}
+
+// Returns the numbers of rows in a table which pass the conditions.
+func matching(t *table.Table, conditions []*Comparison) ([]int, int) {
+	r := ra.New()
+	_, status := r.Load(t)
+	if status != st.OK {
+		return nil, status
+	}
+	status = where(r, conditions)
+	if status != st.OK {
+		return nil, status
+	}
+	return r.Tables[t.Name].RowNumbers, st.OK
+}
+
+func (s *Insert) Execute(db *database.Database, tr *transaction.Transaction) (*Output, int) {
+	t, status := db.Get(s.Table)
+	if status != st.OK {
+		return nil, status
+	}
+	columns := s.Columns
+	if len(columns) == 0 {
+		for _, c := range t.ColumnsInOrder {
+			if !strings.HasPrefix(c.Name, "~") {
+				columns = append(columns, c.Name)
+			}
+		}
+	}
+	if len(columns) != len(s.Values) {
+		return nil, st.ValueCountMismatch
+	}
+	row := make(map[string]string)
+	for i, columnName := range columns {
+		if _, exists := t.Columns[columnName]; !exists {
+			return nil, st.ColumnNameNotFound
+		}
+		row[columnName] = s.Values[i]
+	}
+	return inTransaction(db, tr, func(tr *transaction.Transaction) (int, int) {
+		return 1, tr.Insert(t, row)
+	})
+}
+
+func (s *Update) Execute(db *database.Database, tr *transaction.Transaction) (*Output, int) {
+	t, status := db.Get(s.Table)
+	if status != st.OK {
+		return nil, status
+	}
+	for columnName, _ := range s.Set {
+		if _, exists := t.Columns[columnName]; !exists {
+			return nil, st.ColumnNameNotFound
+		}
+	}
+	return inTransaction(db, tr, func(tr *transaction.Transaction) (int, int) {
+		rowNumbers, status := lockMatching(tr, t, s.Where)
+		if status != st.OK {
+			return 0, status
+		}
+		for _, rowNumber := range rowNumbers {
+			status = tr.Update(t, rowNumber, s.Set)
+			if status != st.OK {
+				return 0, status
+			}
+		}
+		return len(rowNumbers), st.OK
+	})
+}
+
+func (s *Delete) Execute(db *database.Database, tr *transaction.Transaction) (*Output, int) {
+	t, status := db.Get(s.Table)
+	if status != st.OK {
+		return nil, status
+	}
+	return inTransaction(db, tr, func(tr *transaction.Transaction) (int, int) {
+		rowNumbers, status := lockMatching(tr, t, s.Where)
+		if status != st.OK {
+			return 0, status
+		}
+		for _, rowNumber := range rowNumbers {
+			status = tr.Delete(t, rowNumber)
+			if status != st.OK {
+				return 0, status
+			}
+		}
+		return len(rowNumbers), st.OK
+	})
+}
+
+func (s *CreateTable) Execute(db *database.Database, tr *transaction.Transaction) (*Output, int) {
+	t, status := db.Create(s.Table)
+	if status != st.OK {
+		return nil, status
+	}
+	status = s.define(t)
+	if status != st.OK {
+		// Do not leave a table with part of the columns behind.
+		db.Drop(s.Table)
+		return nil, status
+	}
+	return &Output{}, st.OK
+}
+
+// Adds the columns to a newly created table.
+func (s *CreateTable) define(t *table.Table) int {
+	for _, c := range s.Columns {
+		status := t.AddTyped(c.Name, c.Length, c.Type)
+		if status != st.OK {
+			return status
+		}
+	}
+	if s.Versions {
+		status := t.AddVersions()
+		if status != st.OK {
+			return status
+		}
+	}
+	return t.Flush()
+}
+
+func (s *AlterTable) Execute(db *database.Database, tr *transaction.Transaction) (*Output, int) {
+	t, status := db.Get(s.Table)
+	if status != st.OK {
+		return nil, status
+	}
+	return inTransaction(db, tr, func(tr *transaction.Transaction) (int, int) {
+		// The data file may be rebuilt, no one else may read or change the table meanwhile.
+		status := tr.ELock(t)
+		if status != st.OK {
+			return 0, status
+		}
+		switch {
+		case s.Add != nil:
+			status = t.AddTyped(s.Add.Name, s.Add.Length, s.Add.Type)
+		case s.Drop != "":
+			status = t.Remove(s.Drop)
+		case s.RenameTo != "":
+			status = db.Rename(s.Table, s.RenameTo)
+		}
+		return 0, status
+	})
+}
+
+func (s *DropTable) Execute(db *database.Database, tr *transaction.Transaction) (*Output, int) {
+	t, status := db.Get(s.Table)
+	if status != st.OK {
+		return nil, status
+	}
+	return inTransaction(db, tr, func(tr *transaction.Transaction) (int, int) {
+		// No one else may read or change the table while it is removed.
+		status := tr.ELock(t)
+		if status != st.OK {
+			return 0, status
+		}
+		return 0, tr.Drop(t)
+	})
+}
@@ -64,4 +64,27 @@ const (
 	CannotReadFile               = 136
 	CannotWriteFile              = 137
 	CannotRemoveSpecialColumn    = 138
+	InvalidColumnType            = 139
+	CannotOpenTableHeapFile      = 140
+	CannotReadTableHeapFile      = 141
+	CannotWriteTableHeapFile     = 142
+	CannotFlushTableHeapFile     = 143
+	InvalidHeapPointer           = 144
+	CannotOpenWALFile            = 145
+	CannotReadWALFile            = 146
+	CannotWriteWALFile           = 147
+	InvalidWALRecord             = 148
+	CannotCreateIndexFile        = 149
+	CannotOpenIndexFile          = 150
+	CannotReadIndexFile          = 151
+	CannotWriteIndexFile         = 152
+	CannotRemoveIndexFile        = 153
+	InvalidIndexFile             = 154
+	IndexKeyTooLong              = 155
+	CannotCreateTemporaryTable   = 156
+	CannotWriteSortFile          = 157
+	CannotReadSortFile           = 158
+	CannotWriteRegistryFile      = 159
+	CannotReadRegistryDir        = 160
+	CannotReadTableDefFile       = 161
 )
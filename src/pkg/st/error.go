@@ -0,0 +1,162 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/*
+Error values.
+An Error carries a status code together with the context in which it happened, so that callers
+which need more than the bare code may inspect it. Error implements os.Error; Unwrap returns the
+underlying error and Is compares status codes.
+Functions return status codes, an Error of the latest failed operation is kept by transactions,
+tables, indexes, databases, RA results and SQL parser (see their Err). Table file manager, heap,
+sort and write-ahead log return Errors wrapping the OS errors, and Table.Check names the column of
+an invalid value. From carries an Error of the status over to the caller.
+*/
+
+package st
+
+import (
+	"os"
+	"strconv"
+)
+
+// Categories of status codes.
+const (
+	CategoryInfo    = "info"    // 0 - 99, see info.go
+	CategoryErr     = "err"     // 100 - 199, see err.go
+	CategoryWarn    = "warn"    // 200 - 299, see warn.go
+	CategoryLogical = "logical" // 300 - 399, see logical.go
+)
+
+type Error struct {
+	Code     int
+	Category string
+	Message  string   // human readable description
+	Table    string   // name of the table involved, may be empty
+	Column   string   // name of the column involved, may be empty
+	Row      int      // row number involved, -1 if no row is involved
+	Cause    os.Error // the underlying error (usually from OS), may be nil
+}
+
+// Returns the category of a status code.
+func Category(code int) string {
+	switch {
+	case code >= 100 && code < 200:
+		return CategoryErr
+	case code >= 200 && code < 300:
+		return CategoryWarn
+	case code >= 300 && code < 400:
+		return CategoryLogical
+	}
+	return CategoryInfo
+}
+
+// Returns the description of a status code.
+func Message(code int) string {
+	message, exists := messages[code]
+	if !exists {
+		return "status " + strconv.Itoa(code)
+	}
+	return message
+}
+
+// Returns a new Error of the status code, or nil if the status is OK.
+func New(code int) *Error {
+	if code == OK {
+		return nil
+	}
+	return &Error{Code: code, Category: Category(code), Message: Message(code), Row: -1}
+}
+
+// Returns a new Error of the status code, caused by the underlying error.
+func Wrap(code int, cause os.Error) *Error {
+	e := New(code)
+	if e != nil {
+		e.Cause = cause
+	}
+	return e
+}
+
+// Returns an Error of the status code: a copy of the given error if it has the code (it tells more),
+// otherwise a new Error. Returns nil if the status is OK.
+func From(code int, e *Error) *Error {
+	if e.HasCode(code) {
+		copied := *e
+		return &copied
+	}
+	return New(code)
+}
+
+// Sets the table involved in the error.
+func (e *Error) WithTable(name string) *Error {
+	e.Table = name
+	return e
+}
+
+// Sets the column involved in the error.
+func (e *Error) WithColumn(name string) *Error {
+	e.Column = name
+	return e
+}
+
+// Sets the row involved in the error.
+func (e *Error) WithRow(rowNumber int) *Error {
+	e.Row = rowNumber
+	return e
+}
+
+// Returns a description such as "logical 301: duplicated primary key value (table T, column C, row 2)".
+func (e *Error) String() string {
+	description := e.Category + " " + strconv.Itoa(e.Code) + ": " + e.Message
+	context := ""
+	if e.Table != "" {
+		context += ", table " + e.Table
+	}
+	if e.Column != "" {
+		context += ", column " + e.Column
+	}
+	if e.Row != -1 {
+		context += ", row " + strconv.Itoa(e.Row)
+	}
+	if context != "" {
+		description += " (" + context[2:] + ")"
+	}
+	if e.Cause != nil {
+		description += ": " + e.Cause.String()
+	}
+	return description
+}
+
+func (e *Error) Error() string {
+	return e.String()
+}
+
+// Returns the underlying error.
+func (e *Error) Unwrap() os.Error {
+	return e.Cause
+}
+
+// An Error is another Error if they have the same status code, context is not compared.
+func (e *Error) Is(target os.Error) bool {
+	other, ok := target.(*Error)
+	return ok && other != nil && other.Code == e.Code
+}
+
+// Returns true if the error is of the status code.
+func (e *Error) HasCode(code int) bool {
+	return e != nil && e.Code == code
+}
@@ -31,4 +31,26 @@ const (
 	CannotLockInExclusive = 305
 	CannotLockInShared    = 306
 	DuplicatedAlias       = 307
+	InvalidColumnValue    = 308
+	ColumnValueTooLong    = 309
+	IndexAlreadyExists    = 310
+	IndexNotFound         = 311
+	CannotIndexColumnType = 312
+	SQLSyntaxError        = 313
+	AmbiguousColumnName   = 314
+	MissingJoinCondition  = 315
+	UnsupportedCondition  = 316
+	ValueCountMismatch    = 317
+	InvalidAggregate      = 318
+	InvalidCursor         = 319
+	InvalidLimit          = 320
+	Deadlock              = 321
+	LockExpired           = 322
+	RowNumberOutOfRange   = 323
+	DatabaseBusy          = 324
+	TableIsNotVersioned   = 325
+	RowIsDeleted          = 326
+	SavepointNotFound     = 327
+	ResultIsNotEmpty      = 328
+	TableIsChanged        = 329
 )
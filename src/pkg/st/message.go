@@ -0,0 +1,119 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/* Descriptions of status codes. */
+
+package st
+
+var messages = map[int]string{
+	OK:                           "OK",
+	CannotOpenDatabaseDirectory:  "cannot open database directory",
+	CannotReadDatabaseDirectory:  "cannot read database directory",
+	CannotOpenTableFiles:         "cannot open table files",
+	CannotOpenTableDefFile:       "cannot open table definition file",
+	CannotOpenTableDataFile:      "cannot open table data file",
+	InvalidColumnDefinition:      "invalid column definition",
+	CannotStatTableDefFile:       "cannot stat table definition file",
+	CannotStatTableDataFile:      "cannot stat table data file",
+	CannotSeekTableDataFile:      "cannot seek table data file",
+	CannotSeekTableDefFile:       "cannot seek table definition file",
+	CannotReadTableDataFile:      "cannot read table data file",
+	CannotWriteTableDataFile:     "cannot write table data file",
+	CannotWriteTableDefFile:      "cannot write table definition file",
+	CannotFlushTableDefFile:      "cannot flush table definition file",
+	CannotFlushTableDataFile:     "cannot flush table data file",
+	TableDoesNotHaveDelColumn:    "table does not have ~del column",
+	TableNameTooLong:             "table name too long",
+	TableAlreadyExists:           "table already exists",
+	CannotCreateTableFile:        "cannot create table file",
+	CannotCreateTableDir:         "cannot create table directory",
+	CannotRenameTableFile:        "cannot rename table file",
+	CannotRenameTableDir:         "cannot rename table directory",
+	CannotRemoveTableFile:        "cannot remove table file",
+	CannotRemoveTableDir:         "cannot remove table directory",
+	ColumnAlreadyExists:          "column already exists",
+	ColumnNameTooLong:            "column name too long",
+	TableNotFound:                "table not found",
+	InvalidColumnLength:          "invalid column length",
+	AliasNotFound:                "alias not found",
+	AliasAlreadyExists:           "alias already exists",
+	CannotCreateInitFile:         "cannot create init file",
+	CannotReadSharedLocksDir:     "cannot read shared locks directory",
+	CannotReadExclusiveLocksFile: "cannot read exclusive locks file",
+	CannotUnlockSharedLock:       "cannot unlock shared lock",
+	CannotUnlockExclusiveLock:    "cannot unlock exclusive lock",
+	CannotCreateFile:             "cannot create file",
+	CannotReadFile:               "cannot read file",
+	CannotWriteFile:              "cannot write file",
+	CannotRemoveSpecialColumn:    "cannot remove special column",
+	InvalidColumnType:            "invalid column type",
+	CannotOpenTableHeapFile:      "cannot open table heap file",
+	CannotReadTableHeapFile:      "cannot read table heap file",
+	CannotWriteTableHeapFile:     "cannot write table heap file",
+	CannotFlushTableHeapFile:     "cannot flush table heap file",
+	InvalidHeapPointer:           "invalid heap pointer",
+	CannotOpenWALFile:            "cannot open write-ahead log file",
+	CannotReadWALFile:            "cannot read write-ahead log file",
+	CannotWriteWALFile:           "cannot write write-ahead log file",
+	InvalidWALRecord:             "invalid write-ahead log record",
+	CannotCreateIndexFile:        "cannot create index file",
+	CannotOpenIndexFile:          "cannot open index file",
+	CannotReadIndexFile:          "cannot read index file",
+	CannotWriteIndexFile:         "cannot write index file",
+	CannotRemoveIndexFile:        "cannot remove index file",
+	InvalidIndexFile:             "invalid index file",
+	IndexKeyTooLong:              "index key too long",
+	CannotCreateTemporaryTable:   "cannot create temporary table",
+	CannotWriteSortFile:          "cannot write sort file",
+	CannotReadSortFile:           "cannot read sort file",
+	CannotWriteRegistryFile:      "cannot write process registry file",
+	CannotReadRegistryDir:        "cannot read process registry directory",
+	CannotReadTableDefFile:       "cannot read table definition file",
+	ColumnNameNotFound:           "column name not found",
+	FailedToCopyCertainRows:      "failed to copy certain rows",
+	FailedToReadCertainRows:      "failed to read certain rows",
+	DuplicatedPKValue:            "duplicated primary key value",
+	InvalidFKValue:               "invalid foreign key value",
+	DeleteRestricted:             "delete restricted",
+	UpdateRestricted:             "update restricted",
+	CannotLockInExclusive:        "cannot lock in exclusive mode",
+	CannotLockInShared:           "cannot lock in shared mode",
+	DuplicatedAlias:              "duplicated alias",
+	InvalidColumnValue:           "invalid column value",
+	ColumnValueTooLong:           "column value too long",
+	IndexAlreadyExists:           "index already exists",
+	IndexNotFound:                "index not found",
+	CannotIndexColumnType:        "cannot index column type",
+	SQLSyntaxError:               "SQL syntax error",
+	AmbiguousColumnName:          "ambiguous column name",
+	MissingJoinCondition:         "missing join condition",
+	UnsupportedCondition:         "unsupported condition",
+	ValueCountMismatch:           "value count mismatch",
+	InvalidAggregate:             "invalid aggregate function",
+	InvalidCursor:                "invalid cursor",
+	InvalidLimit:                 "invalid limit or offset",
+	Deadlock:                     "deadlock, transaction must be rolled back",
+	LockExpired:                  "lock expired and was reclaimed",
+	RowNumberOutOfRange:          "row number out of range",
+	DatabaseBusy:                 "database is held by a process which does not respond",
+	TableIsNotVersioned:          "table does not have ~creator and ~deleter columns",
+	RowIsDeleted:                 "row is deleted",
+	SavepointNotFound:            "savepoint not found",
+	ResultIsNotEmpty:             "RA result already has tables",
+	TableIsChanged:               "table has uncommitted changes of the transaction",
+}
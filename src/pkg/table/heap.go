@@ -0,0 +1,91 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/*
+Heap file stores values of variable length columns which do not fit in the column.
+
+Values are appended to the end of heap file and never overwritten, the column holds a pointer
+"*offset:length" to the value. Values no longer pointed to are left in heap file until
+the table data file is rebuilt.
+*/
+
+package table
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"column"
+	"constant"
+	"st"
+	"logg"
+)
+
+// Returns the text to be written into a variable length column, or the error wrapping the OS error.
+// The value itself is returned if it fits in the column, otherwise it is stored in heap file
+// and a pointer to it is returned. Values which would read back (trimmed) as a pointer go to heap file too.
+func (table *Table) heapStore(column *column.Column, value string) (string, *st.Error) {
+	if len(value) <= column.Length && !strings.HasPrefix(strings.TrimSpace(value), constant.HeapPointerPrefix) {
+		return value, nil
+	}
+	// Append the value to heap file.
+	heapFileInfo, err := table.HeapFile.Stat()
+	if err != nil {
+		logg.Err("table", "heapStore", err.String())
+		return "", st.Wrap(st.CannotWriteTableHeapFile, err)
+	}
+	offset := heapFileInfo.Size
+	_, err = table.HeapFile.WriteAt([]byte(value), offset)
+	if err != nil {
+		logg.Err("table", "heapStore", err.String())
+		return "", st.Wrap(st.CannotWriteTableHeapFile, err)
+	}
+	return constant.HeapPointerPrefix + strconv.Itoa64(offset) + ":" + strconv.Itoa(len(value)), nil
+}
+
+// Returns the value of a variable length column given the text in the column.
+// If the text is a pointer, the value is read from heap file. Returns the error wrapping the OS error
+// if the value cannot be read.
+func (table *Table) heapLoad(stored string) (string, *st.Error) {
+	if !strings.HasPrefix(stored, constant.HeapPointerPrefix) {
+		return stored, nil
+	}
+	malformed := os.NewError("malformed heap pointer " + stored)
+	offsetLength := strings.Split(stored[len(constant.HeapPointerPrefix):], ":")
+	if len(offsetLength) != 2 {
+		logg.Err("table", "heapLoad", "Malformed heap pointer "+stored+" in table "+table.Name)
+		return "", st.Wrap(st.InvalidHeapPointer, malformed)
+	}
+	offset, err := strconv.Atoi64(offsetLength[0])
+	if err != nil {
+		logg.Err("table", "heapLoad", "Malformed heap pointer "+stored+" in table "+table.Name)
+		return "", st.Wrap(st.InvalidHeapPointer, malformed)
+	}
+	length, err := strconv.Atoi(offsetLength[1])
+	if err != nil {
+		logg.Err("table", "heapLoad", "Malformed heap pointer "+stored+" in table "+table.Name)
+		return "", st.Wrap(st.InvalidHeapPointer, malformed)
+	}
+	buffer := make([]byte, length)
+	_, err = table.HeapFile.ReadAt(buffer, offset)
+	if err != nil {
+		logg.Err("table", "heapLoad", err.String())
+		return "", st.Wrap(st.CannotReadTableHeapFile, err)
+	}
+	return string(buffer), nil
+}
@@ -0,0 +1,242 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/*
+Maintain column indexes of a table.
+
+An index of column COLUMN of table tableName is stored in file tableName.COLUMN.idx,
+indexes are kept up to date when rows are inserted, updated and deleted.
+Deleted rows are not in indexes.
+*/
+
+package table
+
+import (
+	"os"
+	"constant"
+	"index"
+	"st"
+	"logg"
+)
+
+// Returns path to the index file of a column.
+func (table *Table) indexFilePath(columnName string) string {
+	return table.Path + table.Name + "." + columnName + constant.IndexFileExtension
+}
+
+// Opens existing index files of the table's columns.
+func (table *Table) openIndexes() int {
+	table.Indexes = make(map[string]*index.Index)
+	for _, column := range table.ColumnsInOrder {
+		path := table.indexFilePath(column.Name)
+		if _, err := os.Stat(path); err == nil {
+			idx, status := index.Open(path)
+			if status != st.OK {
+				return table.indexFailed(status, idx, column.Name, -1)
+			}
+			table.Indexes[column.Name] = idx
+		}
+	}
+	return st.OK
+}
+
+// Closes index files of the table.
+func (table *Table) closeIndexes() {
+	for _, idx := range table.Indexes {
+		idx.Close()
+	}
+	table.Indexes = make(map[string]*index.Index)
+}
+
+// Creates an index on a column and puts existing rows into the index.
+func (table *Table) CreateIndex(columnName string) int {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	return table.createIndex(columnName)
+}
+
+// Creates an index without locking the table.
+func (table *Table) createIndex(columnName string) int {
+	theColumn, exists := table.Columns[columnName]
+	if !exists {
+		return table.fail(st.New(st.ColumnNameNotFound).WithColumn(columnName))
+	}
+	if _, exists := table.Indexes[columnName]; exists {
+		return table.fail(st.New(st.IndexAlreadyExists).WithColumn(columnName))
+	}
+	// Long text values are not stored in the column, they cannot be keys.
+	if theColumn.IsVariable() {
+		return table.fail(st.New(st.CannotIndexColumnType).WithColumn(columnName))
+	}
+	idx, status := index.Create(table.indexFilePath(columnName), theColumn.Length, theColumn.Type)
+	// On failure the index file is removed, the column may be indexed again later.
+	discard := func(status int) int {
+		idx.Close()
+		os.Remove(table.indexFilePath(columnName))
+		return status
+	}
+	if status != st.OK {
+		return discard(table.indexFailed(status, idx, columnName, -1))
+	}
+	numberOfRows, status := table.numberOfRows()
+	if status != st.OK {
+		return discard(status)
+	}
+	for i := 0; i < numberOfRows; i++ {
+		row, status := table.readEncoded(i)
+		if status != st.OK {
+			return discard(status)
+		}
+		if row["~del"] != "y" {
+			status = idx.Insert(row[columnName], i)
+			if status != st.OK {
+				return discard(table.indexFailed(status, idx, columnName, i))
+			}
+		}
+	}
+	if status = idx.Flush(); status != st.OK {
+		return discard(table.indexFailed(status, idx, columnName, -1))
+	}
+	table.Indexes[columnName] = idx
+	return st.OK
+}
+
+// Removes the index of a column.
+func (table *Table) DropIndex(columnName string) int {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	return table.dropIndex(columnName)
+}
+
+// Removes the index of a column without locking the table.
+func (table *Table) dropIndex(columnName string) int {
+	idx, exists := table.Indexes[columnName]
+	if !exists {
+		return table.fail(st.New(st.IndexNotFound).WithColumn(columnName))
+	}
+	idx.Close()
+	table.Indexes[columnName] = nil, false
+	err := os.Remove(idx.Path)
+	if err != nil {
+		logg.Err("table", "DropIndex", err.String())
+		return table.fail(st.Wrap(st.CannotRemoveIndexFile, err).WithColumn(columnName))
+	}
+	return st.OK
+}
+
+// Returns the index of a column, or nil if the column is not indexed.
+func (table *Table) Index(columnName string) *index.Index {
+	table.mutex.RLock()
+	defer table.mutex.RUnlock()
+	idx, exists := table.Indexes[columnName]
+	if !exists {
+		return nil
+	}
+	return idx
+}
+
+// Converts a value into index key for a column.
+// The second return value is false if the value cannot be stored in the column.
+func (table *Table) IndexKey(columnName, value string) (string, bool) {
+	theColumn, exists := table.Columns[columnName]
+	if !exists {
+		return "", false
+	}
+	key, status := theColumn.Encode(value)
+	if status != st.OK || len(key) > theColumn.Length {
+		return "", false
+	}
+	return key, true
+}
+
+// Reads a row with values in the form stored in data file (which are index keys).
+func (table *Table) readEncoded(rowNumber int) (map[string]string, int) {
+	row, status := table.read(rowNumber)
+	if status != st.OK {
+		return nil, status
+	}
+	for name, value := range row {
+		row[name], status = table.Columns[name].Encode(value)
+		if status != st.OK {
+			return nil, table.fail(st.New(status).WithColumn(name).WithRow(rowNumber))
+		}
+	}
+	return row, st.OK
+}
+
+// Updates indexes for a row which has changed from "before" to "after".
+// Both are encoded rows; a nil row, or a row with ~del "y", is not in indexes.
+func (table *Table) reindex(rowNumber int, before, after map[string]string) int {
+	beforeLive := before != nil && before["~del"] != "y"
+	afterLive := after != nil && after["~del"] != "y"
+	for columnName, idx := range table.Indexes {
+		changed := !beforeLive || !afterLive || before[columnName] != after[columnName]
+		if !changed {
+			continue
+		}
+		if beforeLive {
+			status := idx.Delete(before[columnName], rowNumber)
+			if status != st.OK {
+				return table.indexFailed(status, idx, columnName, rowNumber)
+			}
+		}
+		if afterLive {
+			status := idx.Insert(after[columnName], rowNumber)
+			if status != st.OK {
+				return table.indexFailed(status, idx, columnName, rowNumber)
+			}
+		}
+	}
+	return st.OK
+}
+
+// Re-creates the indexes of all indexed columns from table data, e.g. when they may be out of date
+// after a crash.
+func (table *Table) RebuildIndexes() int {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	indexed := make([]string, 0)
+	for columnName, _ := range table.Indexes {
+		indexed = append(indexed[:], columnName)
+	}
+	return table.rebuildIndexes(indexed)
+}
+
+// Re-creates all indexes, called after row numbers have changed.
+func (table *Table) rebuildIndexes(columnNames []string) int {
+	table.closeIndexes()
+	for _, columnName := range columnNames {
+		os.Remove(table.indexFilePath(columnName))
+		status := table.createIndex(columnName)
+		if status != st.OK {
+			return status
+		}
+	}
+	return st.OK
+}
+
+// Flushes index files.
+func (table *Table) flushIndexes() int {
+	for columnName, idx := range table.Indexes {
+		status := idx.Flush()
+		if status != st.OK {
+			return table.indexFailed(status, idx, columnName, -1)
+		}
+	}
+	return st.OK
+}
@@ -32,14 +32,34 @@ tableName.def - column definitions, e.g.
 NAME:20
 SITE:20
 USERNAME:40
+AGE:3:int
+
+Columns may carry a type (see package column), values are validated and encoded
+according to column type when they are written.
+
+tableName.COLUMN.idx - index of column COLUMN (see package index).
+
+tableName.heap - values of text columns which are too long to fit in the column, the
+column holds a pointer "*offset:length" to the value in heap file instead.
 
 Note that ~del is a special column, if ~del is set to "y", it means the row is deleted.
+Tables having special columns ~creator and ~deleter keep multiple versions of rows (see version.go).
 
 tableName.exclusive - when the table is exclusively locked by a transaction, the 
-file is created and the content of the file is the ID of the transaction.
+file is created and the content of the file is the lease of the lock (see package transaction).
 
-tableName.shared (directory) - when the table is locked by a transaction in shared mode, 
-a file is created, the file name is the ID of the transaction.
+tableName.shared (directory) - when the table is locked by a transaction in shared or intention mode, 
+a file is created, the file name is the ID of the transaction and the content is the lease; a row
+locked by a transaction has a file named ID.ROW (see package transaction).
+
+A Table is safe for concurrent use. Rows are read and written at their offsets (ReadAt, WriteAt)
+instead of through the file cursor; reads share a lock, while inserts, updates, deletes, index and
+schema changes hold it exclusively. Seek, SeekColumn and Write work on the file cursor and are left
+for single goroutine use. Columns and ColumnsInOrder change with the schema, goroutines reading them
+should not run at the same time as Add, Remove or RebuildDataFile.
+
+The error of the latest failed operation on a table, naming the column and row involved and wrapping
+the OS error, is kept by the table (see Err).
 
 This package handles basic, low-level table logics. 
 */
@@ -48,6 +68,8 @@ package table
 
 import (
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 	"strings"
 	"strconv"
@@ -56,20 +78,32 @@ import (
 	"st"
 	"util"
 	"logg"
+	"index"
+	"snapshot"
 	"tablefilemanager"
 )
 
 type Table struct {
 	// Path is the table's database's path, must end with /
-	Path, Name, DefFilePath, DataFilePath string
-	DefFile, DataFile                     *os.File
-	Columns                               map[string]*column.Column
-	RowLength                             int
+	Path, Name, DefFilePath, DataFilePath, HeapFilePath string
+	DefFile, DataFile, HeapFile                         *os.File
+	Columns                                             map[string]*column.Column
+	RowLength                                           int
 	// sequence of columns
 	ColumnsInOrder []*column.Column
+	// indexes of columns (column name to index)
+	Indexes map[string]*index.Index
+	// number of rows read by Read, for explaining queries
+	reads int64
+	// Reads share the mutex, changes of rows, indexes and schema hold it exclusively.
+	mutex sync.RWMutex
+	// error of the latest failed operation
+	err      *st.Error
+	errMutex sync.Mutex
 }
 
 // Opens a table.
+// If opening fails, the returned table is only good for telling the error (see Err).
 func Open(path, name string) (*Table, int) {
 	var table *Table
 	table = new(Table)
@@ -77,20 +111,48 @@ func Open(path, name string) (*Table, int) {
 	table.Name = name
 	status := table.Init()
 	if status != st.OK {
-		logg.Err("table", "Open", "Failed to open"+path+name+" Err: "+string(status))
-		return nil, status
+		logg.Err("table", "Open", "Failed to open "+path+name+": "+table.Err().String())
+		return table, status
 	}
 	return table, st.OK
 }
 
+// Returns the error of the latest failed operation on the table, nil if no operation has failed.
+func (table *Table) Err() *st.Error {
+	table.errMutex.Lock()
+	defer table.errMutex.Unlock()
+	return table.err
+}
+
+// Remembers the error of a failed operation, returns its status code.
+func (table *Table) fail(e *st.Error) int {
+	table.errMutex.Lock()
+	defer table.errMutex.Unlock()
+	table.err = e.WithTable(table.Name)
+	return e.Code
+}
+
+// Remembers the error of a failed index operation, the index's error tells more if it has the status.
+func (table *Table) indexFailed(status int, idx *index.Index, columnName string, rowNumber int) int {
+	return table.fail(st.From(status, idx.Err()).WithColumn(columnName).WithRow(rowNumber))
+}
+
 // Load the table (column definitions, etc.).
 func (table *Table) Init() int {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	return table.load()
+}
+
+// Loads the table without locking it.
+func (table *Table) load() int {
 	// This function may be called multiple times, thus clear previous state.
 	table.RowLength = 0
 	table.Columns = make(map[string]*column.Column)
 	table.ColumnsInOrder = make([]*column.Column, 0)
 	table.DefFilePath = table.Path + table.Name + ".def"
 	table.DataFilePath = table.Path + table.Name + ".data"
+	table.HeapFilePath = table.Path + table.Name + ".heap"
 	status := table.OpenFiles()
 	if status != st.OK {
 		return status
@@ -98,11 +160,15 @@ func (table *Table) Init() int {
 	defFileInfo, err := table.DefFile.Stat()
 	if err != nil {
 		logg.Err("table", "Init", err.String())
-		return st.CannotStatTableDefFile
+		return table.fail(st.Wrap(st.CannotStatTableDefFile, err))
 	}
 	// Read definition file into memeory.
 	content := make([]byte, defFileInfo.Size)
-	table.DefFile.Read(content)
+	_, err = table.DefFile.ReadAt(content, 0)
+	if err != nil {
+		logg.Err("table", "Init", err.String())
+		return table.fail(st.Wrap(st.CannotReadTableDefFile, err))
+	}
 	// Each line contains one column definition.
 	lines := strings.Split(string(content), "\n")
 	for _, line := range lines {
@@ -111,7 +177,7 @@ func (table *Table) Init() int {
 			// Convert the definition into a Column.
 			aColumn, status = column.ColumnFromDef(table.RowLength, line)
 			if status != st.OK {
-				return status
+				return table.fail(st.Wrap(status, os.NewError("invalid column definition "+line)))
 			}
 			table.Columns[aColumn.Name] = aColumn
 			table.ColumnsInOrder = append(table.ColumnsInOrder[:], aColumn)
@@ -119,7 +185,7 @@ func (table *Table) Init() int {
 		}
 	}
 	table.RowLength++
-	return st.OK
+	return table.openIndexes()
 }
 
 // Opens file handles.
@@ -130,31 +196,60 @@ func (table *Table) OpenFiles() int {
 		table.DataFile, err = os.OpenFile(table.DataFilePath, os.O_RDWR, constant.DataFilePerm)
 		if err != nil {
 			logg.Err("table", "OpenFiles", err.String())
-			return st.CannotOpenTableDataFile
+			return table.fail(st.Wrap(st.CannotOpenTableDataFile, err))
+		}
+		// Tables created by earlier versions do not have heap file.
+		table.HeapFile, err = os.OpenFile(table.HeapFilePath, os.O_RDWR|os.O_CREATE, constant.HeapFilePerm)
+		if err != nil {
+			logg.Err("table", "OpenFiles", err.String())
+			return table.fail(st.Wrap(st.CannotOpenTableHeapFile, err))
 		}
 	} else {
 		logg.Err("table", "OpenFiles", err.String())
-		return st.CannotOpenTableDefFile
+		return table.fail(st.Wrap(st.CannotOpenTableDefFile, err))
 	}
 	return st.OK
 }
 
 // Flushes table's files
 func (table *Table) Flush() int {
+	table.mutex.RLock()
+	defer table.mutex.RUnlock()
 	err := table.DefFile.Sync()
 	if err == nil {
 		err = table.DataFile.Sync()
 		if err != nil {
 			logg.Err("table", "Flush", err.String())
-			return st.CannotFlushTableDataFile
+			return table.fail(st.Wrap(st.CannotFlushTableDataFile, err))
+		}
+		err = table.HeapFile.Sync()
+		if err != nil {
+			logg.Err("table", "Flush", err.String())
+			return table.fail(st.Wrap(st.CannotFlushTableHeapFile, err))
 		}
 	} else {
-		return st.CannotFlushTableDefFile
+		logg.Err("table", "Flush", err.String())
+		return table.fail(st.Wrap(st.CannotFlushTableDefFile, err))
 	}
-	return st.OK
+	return table.flushIndexes()
+}
+
+// Closes table's files and index files.
+func (table *Table) Close() {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	table.closeFiles()
 }
 
-// Seeks to a row (e.g. row number 10).
+// Closes all files of the table without locking the table.
+func (table *Table) closeFiles() {
+	table.closeIndexes()
+	table.DefFile.Close()
+	table.DataFile.Close()
+	table.HeapFile.Close()
+}
+
+// Seeks to a row (e.g. row number 10), moving the file cursor.
 func (table *Table) Seek(rowNumber int) int {
 	var numberOfRows int
 	numberOfRows, status := table.NumberOfRows()
@@ -162,7 +257,7 @@ func (table *Table) Seek(rowNumber int) int {
 		_, err := table.DataFile.Seek(int64(rowNumber*table.RowLength), 0)
 		if err != nil {
 			logg.Err("table", "Seek", err.String())
-			return st.CannotSeekTableDataFile
+			return table.fail(st.Wrap(st.CannotSeekTableDataFile, err).WithRow(rowNumber))
 		}
 	}
 	return st.OK
@@ -177,7 +272,7 @@ func (table *Table) SeekColumn(rowNumber int, columnName string) int {
 			_, err := table.DataFile.Seek(int64(column.Offset), 1)
 			if err != nil {
 				logg.Err("table", "SeekColumn", err.String())
-				return st.CannotSeekTableDataFile
+				return table.fail(st.Wrap(st.CannotSeekTableDataFile, err).WithColumn(columnName).WithRow(rowNumber))
 			}
 		}
 	}
@@ -186,150 +281,362 @@ func (table *Table) SeekColumn(rowNumber int, columnName string) int {
 
 // Returns the number of rows in this table.
 func (table *Table) NumberOfRows() (int, int) {
+	table.mutex.RLock()
+	defer table.mutex.RUnlock()
+	return table.numberOfRows()
+}
+
+// Returns the number of rows without locking the table.
+func (table *Table) numberOfRows() (int, int) {
 	var numberOfRows int
 	var dataFileInfo *os.FileInfo
 	dataFileInfo, err := table.DataFile.Stat()
 	if err != nil {
 		logg.Err("table", "NumberOfRows", err.String())
-		return 0, st.CannotStatTableDataFile
+		return 0, table.fail(st.Wrap(st.CannotStatTableDataFile, err))
 	}
 	numberOfRows = int(dataFileInfo.Size) / table.RowLength
 	return numberOfRows, st.OK
 }
 
+// Returns the number of rows read by Read since the table was opened.
+func (table *Table) NumberOfReads() int {
+	return int(atomic.AddInt64(&table.reads, 0))
+}
+
+// Returns the offset of a row in data file, or RowNumberOutOfRange if the row does not exist.
+func (table *Table) rowOffset(rowNumber int) (int64, int) {
+	numberOfRows, status := table.numberOfRows()
+	if status != st.OK {
+		return 0, status
+	}
+	if rowNumber < 0 || rowNumber >= numberOfRows {
+		return 0, table.fail(st.New(st.RowNumberOutOfRange).WithRow(rowNumber))
+	}
+	return int64(rowNumber * table.RowLength), st.OK
+}
+
 // Reads a row and return a map representation (name1:value1, name2:value2...)
 func (table *Table) Read(rowNumber int) (map[string]string, int) {
+	table.mutex.RLock()
+	defer table.mutex.RUnlock()
+	return table.read(rowNumber)
+}
+
+// Reads a row without locking the table.
+func (table *Table) read(rowNumber int) (map[string]string, int) {
+	atomic.AddInt64(&table.reads, 1)
 	row := make(map[string]string)
-	status := table.Seek(rowNumber)
-	if status == st.OK {
-		rowInBytes := make([]byte, table.RowLength)
-		_, err := table.DataFile.Read(rowInBytes)
-		if err == nil {
-			// For the columns in their order
-			for _, column := range table.ColumnsInOrder {
-				// column1:value2, column2:value2...
-				row[column.Name] = strings.TrimSpace(string(rowInBytes[column.Offset : column.Offset+column.Length]))
+	rowInBytes := make([]byte, table.RowLength)
+	_, err := table.DataFile.ReadAt(rowInBytes, int64(rowNumber*table.RowLength))
+	if err != nil {
+		logg.Err("table", "Read", err.String())
+		return nil, table.fail(st.Wrap(st.CannotReadTableDataFile, err).WithRow(rowNumber))
+	}
+	// For the columns in their order
+	for _, column := range table.ColumnsInOrder {
+		stored := strings.TrimSpace(string(rowInBytes[column.Offset : column.Offset+column.Length]))
+		// Long values of variable length columns are in heap file.
+		if column.IsVariable() {
+			var e *st.Error
+			stored, e = table.heapLoad(stored)
+			if e != nil {
+				return nil, table.fail(e.WithColumn(column.Name).WithRow(rowNumber))
 			}
-		} else {
-			logg.Err("table", "Read", err.String())
-			return nil, st.CannotReadTableDataFile
+		}
+		// column1:value2, column2:value2...
+		var status int
+		row[column.Name], status = column.Decode(stored)
+		if status != st.OK {
+			return nil, table.fail(st.New(status).WithColumn(column.Name).WithRow(rowNumber))
 		}
 	}
 	return row, st.OK
 }
 
-// Writes a column value without seeking to a cursor position.
+// Reads a row and return a map representation with values converted according to column types.
+// Columns without value are mapped to nil.
+func (table *Table) ReadTyped(rowNumber int) (map[string]interface{}, int) {
+	row, status := table.Read(rowNumber)
+	if status != st.OK {
+		return nil, status
+	}
+	typed := make(map[string]interface{})
+	for name, value := range row {
+		column := table.Columns[name]
+		// Values read from table are decoded, encode them again before conversion.
+		stored, status := column.Encode(value)
+		if status != st.OK {
+			return nil, table.fail(st.New(status).WithColumn(name).WithRow(rowNumber))
+		}
+		typed[name], status = column.Value(stored)
+		if status != st.OK {
+			return nil, table.fail(st.New(status).WithColumn(name).WithRow(rowNumber))
+		}
+	}
+	return typed, st.OK
+}
+
+// Validates the values of a row according to column types, the error names the column of an invalid value.
+// Columns which are not in the table are ignored.
+func (table *Table) Check(row map[string]string) *st.Error {
+	for name, value := range row {
+		if column, exists := table.Columns[name]; exists {
+			if _, status := column.Encode(value); status != st.OK {
+				return st.New(status).WithTable(table.Name).WithColumn(name)
+			}
+		}
+	}
+	return nil
+}
+
+// Validates and encodes the values of a row according to column types.
+// Values of fixed length columns are truncated to column length and trimmed, as they are read back
+// from data file, so that they are the index keys of the row.
+// Columns which are not in the table are left out. The error of an invalid value names its column.
+func (table *Table) encode(row map[string]string) (map[string]string, int) {
+	encoded := make(map[string]string)
+	for name, value := range row {
+		column, exists := table.Columns[name]
+		if exists {
+			value, status := column.Encode(value)
+			if status != st.OK {
+				return nil, table.fail(st.New(status).WithColumn(name))
+			}
+			if !column.IsVariable() {
+				if len(value) > column.Length {
+					logg.Warn("table", "encode", "Value of column "+column.Name+" in table "+table.Name+" is truncated")
+				}
+				value = strings.TrimSpace(util.TrimLength(value, column.Length))
+			}
+			encoded[name] = value
+		}
+	}
+	return encoded, st.OK
+}
+
+// Returns the text to be written into a column of a row, long values of variable length columns are
+// stored in heap file.
+func (table *Table) stored(column *column.Column, value string, rowNumber int) (string, int) {
+	if column.IsVariable() {
+		// Long values of variable length columns go to heap file.
+		var e *st.Error
+		value, e = table.heapStore(column, value)
+		if e != nil {
+			return "", table.fail(e.WithColumn(column.Name).WithRow(rowNumber))
+		}
+	} else if len(value) > column.Length {
+		logg.Warn("table", "Write", "Value of column "+column.Name+" in table "+table.Name+" is truncated")
+	}
+	return util.TrimLength(value, column.Length), st.OK
+}
+
+// Writes a column value at the file cursor.
 func (table *Table) Write(column *column.Column, value string) int {
-	_, err := table.DataFile.WriteString(util.TrimLength(value, column.Length))
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	value, status := table.stored(column, value, -1)
+	if status != st.OK {
+		return status
+	}
+	_, err := table.DataFile.WriteString(value)
+	if err != nil {
+		logg.Err("table", "Write", err.String())
+		return table.fail(st.Wrap(st.CannotWriteTableDataFile, err).WithColumn(column.Name))
+	}
+	return st.OK
+}
+
+// Writes a column value of a row.
+func (table *Table) writeAt(column *column.Column, value string, rowOffset int64) int {
+	rowNumber := int(rowOffset / int64(table.RowLength))
+	value, status := table.stored(column, value, rowNumber)
+	if status != st.OK {
+		return status
+	}
+	_, err := table.DataFile.WriteAt([]byte(value), rowOffset+int64(column.Offset))
 	if err != nil {
-		return st.CannotWriteTableDataFile
+		logg.Err("table", "writeAt", err.String())
+		return table.fail(st.Wrap(st.CannotWriteTableDataFile, err).WithColumn(column.Name).WithRow(rowNumber))
 	}
 	return st.OK
 }
 
 // Inserts a row to the bottom of the table.
 func (table *Table) Insert(row map[string]string) int {
-	// Seek to EOF
-	_, err := table.DataFile.Seek(0, 2)
-	if err == nil {
-		// For the columns in their order
-		for _, column := range table.ColumnsInOrder {
-			value, exists := row[column.Name]
-			if !exists {
-				value = ""
-			}
-			// Keep writing the column value.
-			status := table.Write(column, value)
-			if status != st.OK {
-				return status
-			}
-		}
-		// Write a new-line character.
-		_, err = table.DataFile.WriteString("\n")
-		if err != nil {
-			logg.Err("table", "Insert", err.String())
-			return st.CannotWriteTableDataFile
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	_, status := table.insert(row)
+	return status
+}
+
+// Inserts a row without locking the table, returns the new row's number.
+func (table *Table) insert(row map[string]string) (int, int) {
+	// Validate all values before writing anything.
+	row, status := table.encode(row)
+	if status != st.OK {
+		return 0, status
+	}
+	// The new row's number is the current number of rows.
+	numberOfRows, status := table.numberOfRows()
+	if status != st.OK {
+		return 0, status
+	}
+	// Put together the row and write it at the end of data file at once.
+	line := make([]string, 0, len(table.ColumnsInOrder)+1)
+	for _, column := range table.ColumnsInOrder {
+		value, status := table.stored(column, row[column.Name], numberOfRows)
+		if status != st.OK {
+			return 0, status
 		}
-	} else {
+		line = append(line, value)
+	}
+	line = append(line, "\n")
+	_, err := table.DataFile.WriteAt([]byte(strings.Join(line, "")), int64(numberOfRows*table.RowLength))
+	if err != nil {
 		logg.Err("table", "Insert", err.String())
-		return st.CannotSeekTableDataFile
+		return 0, table.fail(st.Wrap(st.CannotWriteTableDataFile, err).WithRow(numberOfRows))
 	}
-	return st.OK
+	// Put the new row into indexes.
+	return numberOfRows, table.reindex(numberOfRows, nil, row)
+}
+
+// Appends a row marked deleted, which holds the place of a row written later by Update.
+// Returns the row number.
+func (table *Table) Reserve() (int, int) {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	return table.insert(map[string]string{"~del": "y"})
 }
 
 // Deletes a row.
 func (table *Table) Delete(rowNumber int) int {
-	status := table.Seek(rowNumber)
-	if status == st.OK {
-		del, exists := table.Columns["~del"]
-		if exists {
-			// Set ~del column value to "y" indicating the row is deleted
-			return table.Write(del, "y")
-		} else {
-			return st.TableDoesNotHaveDelColumn
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	rowOffset, status := table.rowOffset(rowNumber)
+	if status != st.OK {
+		return status
+	}
+	del, exists := table.Columns["~del"]
+	if !exists {
+		return table.fail(st.New(st.TableDoesNotHaveDelColumn).WithRow(rowNumber))
+	}
+	// Remember the row's values to remove them from indexes.
+	var before map[string]string
+	if len(table.Indexes) > 0 {
+		before, status = table.readEncoded(rowNumber)
+		if status != st.OK {
+			return status
 		}
 	}
-	return st.OK
+	// Set ~del column value to "y" indicating the row is deleted
+	status = table.writeAt(del, "y", rowOffset)
+	if status != st.OK {
+		return status
+	}
+	return table.reindex(rowNumber, before, nil)
 }
 
 // Updates a row.
 func (table *Table) Update(rowNumber int, row map[string]string) int {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	return table.update(rowNumber, row)
+}
+
+// Updates a row without locking the table.
+func (table *Table) update(rowNumber int, row map[string]string) int {
+	rowOffset, status := table.rowOffset(rowNumber)
+	if status != st.OK {
+		return status
+	}
+	// Validate all values before writing anything.
+	row, status = table.encode(row)
+	if status != st.OK {
+		return status
+	}
+	// Remember the row's values to update indexes.
+	var before map[string]string
+	if len(table.Indexes) > 0 {
+		before, status = table.readEncoded(rowNumber)
+		if status != st.OK {
+			return status
+		}
+	}
 	for columnName, value := range row {
 		column, exists := table.Columns[columnName]
 		if exists {
-			// Seek to the row and column, then write value in.
-			status := table.SeekColumn(rowNumber, column.Name)
-			if status != st.OK {
-				return status
-			}
-			status = table.Write(column, value)
+			status = table.writeAt(column, value, rowOffset)
 			if status != st.OK {
 				return status
 			}
 		}
 	}
+	if before != nil {
+		after := make(map[string]string)
+		for name, value := range before {
+			after[name] = value
+		}
+		for name, value := range row {
+			after[name] = value
+		}
+		return table.reindex(rowNumber, before, after)
+	}
 	return st.OK
 }
 
 // Puts a new column.
-func (table *Table) pushNewColumn(name string, length int) *column.Column {
-	newColumn := &column.Column{Name: name, Offset: table.RowLength - 1, Length: length}
+func (table *Table) pushNewColumn(name string, length int, columnType string) *column.Column {
+	newColumn := &column.Column{Name: name, Offset: table.RowLength - 1, Length: length, Type: columnType}
 	table.ColumnsInOrder = append(table.ColumnsInOrder[:], newColumn)
 	table.Columns[name] = newColumn
 	return newColumn
 }
 
-// Adds a new column.
+// Adds a new string column.
 func (table *Table) Add(name string, length int) int {
+	return table.AddTyped(name, length, column.String)
+}
+
+// Adds a new column of the type.
+func (table *Table) AddTyped(name string, length int, columnType string) int {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
 	_, exists := table.Columns[name]
 	if exists {
-		return st.ColumnAlreadyExists
+		return table.fail(st.New(st.ColumnAlreadyExists).WithColumn(name))
 	}
 	if len(name) > constant.MaxColumnNameLength {
-		return st.ColumnNameTooLong
+		return table.fail(st.New(st.ColumnNameTooLong).WithColumn(name))
 	}
 	if length <= 0 {
-		return st.InvalidColumnLength
+		return table.fail(st.New(st.InvalidColumnLength).WithColumn(name))
+	}
+	if !column.ValidType(columnType) {
+		return table.fail(st.New(st.InvalidColumnType).WithColumn(name))
+	}
+	// Variable length column must be able to hold a pointer to heap file.
+	if columnType == column.Text && length < constant.MinTextColumnLength {
+		return table.fail(st.New(st.InvalidColumnLength).WithColumn(name))
 	}
 	var numberOfRows int
-	numberOfRows, status := table.NumberOfRows()
+	numberOfRows, status := table.numberOfRows()
 	if status == st.OK && numberOfRows > 0 {
 		// Rebuild data file if there are already rows in the table.
-		// (To leave space for the new column)
-		status = table.RebuildDataFile(name, length)
-		table.pushNewColumn(name, length)
+		// (To leave space for the new column, the table is reloaded with the new column)
+		return table.rebuildDataFile(name, length, columnType)
 	} else {
-		newColumn := table.pushNewColumn(name, length)
-		// Write definition of the new column into definition file.
-		_, err := table.DefFile.Seek(0, 2)
+		newColumn := table.pushNewColumn(name, length, columnType)
+		// Write definition of the new column at the end of definition file.
+		defFileInfo, err := table.DefFile.Stat()
 		if err != nil {
 			logg.Err("table", "Add", err.String())
-			return st.CannotSeekTableDefFile
+			return table.fail(st.Wrap(st.CannotStatTableDefFile, err).WithColumn(name))
 		}
-		_, err = table.DefFile.WriteString(column.ColumnToDef(newColumn))
+		_, err = table.DefFile.WriteAt([]byte(column.ColumnToDef(newColumn)), defFileInfo.Size)
 		if err != nil {
 			logg.Err("table", "Add", err.String())
-			return st.CannotWriteTableDefFile
+			return table.fail(st.Wrap(st.CannotWriteTableDefFile, err).WithColumn(name))
 		}
 	}
 	table.RowLength += length
@@ -338,6 +645,8 @@ func (table *Table) Add(name string, length int) int {
 
 // Removes a column.
 func (table *Table) Remove(name string) int {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
 	var theColumn *column.Column
 	// Find index of the column.
 	var columnIndex int
@@ -349,97 +658,130 @@ func (table *Table) Remove(name string) int {
 		}
 	}
 	if theColumn == nil {
-		return st.ColumnNameNotFound
+		return table.fail(st.New(st.ColumnNameNotFound).WithColumn(name))
 	}
 	if strings.HasPrefix(name, "~") {
-		return st.CannotRemoveSpecialColumn
+		return table.fail(st.New(st.CannotRemoveSpecialColumn).WithColumn(name))
+	}
+	if _, indexed := table.Indexes[name]; indexed {
+		status := table.dropIndex(name)
+		if status != st.OK {
+			return status
+		}
 	}
 	length := theColumn.Length
 	// Remove the column from columns array.
 	table.ColumnsInOrder = append(table.ColumnsInOrder[:columnIndex], table.ColumnsInOrder[columnIndex+1:]...)
 	// Remove the column from columns map.
 	table.Columns[name] = nil, true
-	numberOfRows, status := table.NumberOfRows()
+	numberOfRows, status := table.numberOfRows()
 	if status != st.OK {
 		return status
 	}
 	if numberOfRows > 0 {
 		// Rebuild data file if there are already rows in the table.
-		// (To remove data in the deleted column)
-		status = table.RebuildDataFile("", 0)
-	} else {
-		status = util.RemoveLine(table.DefFilePath, column.ColumnToDef(theColumn))
+		// (To remove data in the deleted column, the table is reloaded without the column)
+		return table.rebuildDataFile("", 0, "")
 	}
+	status = util.RemoveLine(table.DefFilePath, column.ColumnToDef(theColumn))
 	table.RowLength -= length
 	if status != st.OK {
-		return status
+		return table.fail(st.New(status).WithColumn(name))
 	}
 	return st.OK
 }
 
-// Rebuild data file, get rid off removed rows, optionally leaves space for a new column.
-func (table *Table) RebuildDataFile(name string, length int) int {
+// Rebuild data file, get rid off removed rows and old row versions, optionally leaves space for a new column.
+// The table must be locked exclusively (see package transaction). Row numbers change, thus removed rows are
+// kept while transactions are writing or snapshots are in use (see snapshot.Idle).
+func (table *Table) RebuildDataFile(name string, length int, columnType string) int {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	return table.rebuildDataFile(name, length, columnType)
+}
+
+// Rebuilds data file without locking the table.
+func (table *Table) rebuildDataFile(name string, length int, columnType string) int {
 	// Create a temporary table named by an accurate timestamp.
 	tempName := strconv.Itoa64(time.Nanoseconds())
-	tablefilemanager.Create(table.Path, tempName)
+	if e := tablefilemanager.Create(table.Path, tempName); e != nil {
+		return table.fail(e)
+	}
 	var tempTable *Table
 	tempTable, status := Open(table.Path, tempName)
+	// On failure the temporary table is removed and this table is left untouched.
+	discard := func(e *st.Error) int {
+		tempTable.Close()
+		tablefilemanager.Delete(table.Path, tempName)
+		return table.fail(e)
+	}
 	if status != st.OK {
-		return status
+		return discard(st.From(status, tempTable.Err()))
 	}
 	// Put all columns of this table to the temporary table.
 	for _, column := range table.ColumnsInOrder {
-		tempTable.Add(column.Name, column.Length)
+		if status = tempTable.AddTyped(column.Name, column.Length, column.Type); status != st.OK {
+			return discard(st.From(status, tempTable.Err()))
+		}
 	}
 	// Add the new column into the table as well.
 	if name != "" {
-		tempTable.Add(name, length)
+		if status = tempTable.AddTyped(name, length, columnType); status != st.OK {
+			return discard(st.From(status, tempTable.Err()))
+		}
 	}
 	var numberOfRows int
-	numberOfRows, status = table.NumberOfRows()
+	numberOfRows, status = table.numberOfRows()
 	if status != st.OK {
-		return status
+		return discard(st.From(status, table.Err()))
 	}
+	// Removed rows are copied as well if someone may hold row numbers.
+	collect := snapshot.Idle()
 	var everFailed bool
-	if name == "" {
-		// If no new column, simply copy rows from this table to the temp table.
-		for i := 0; i < numberOfRows; i++ {
-			row, ret := table.Read(i)
-			if ret != st.OK {
-				everFailed = true
-			}
-			if row["~del"] != "y" {
-				tempTable.Insert(row)
-			}
+	for i := 0; i < numberOfRows; i++ {
+		row, ret := table.read(i)
+		if ret != st.OK {
+			everFailed = true
+			continue
 		}
-	} else {
-		// If adding new column, not only copy rows from this table to the temporary one.
-		// Also leave space for the new column's values.
-		for i := 0; i < numberOfRows; i++ {
-			row, ret := table.Read(i)
-			if ret != st.OK {
-				everFailed = true
-			}
-			if row["~del"] != "y" {
-				row[name] = ""
-				tempTable.Insert(row)
-			}
+		if collect && row["~del"] == "y" {
+			continue
+		}
+		// If adding new column, also leave space for the new column's values.
+		if name != "" {
+			row[name] = ""
+		}
+		if tempTable.Insert(row) != st.OK {
+			everFailed = true
 		}
 	}
 	// Flush all the changes made to temporary table.
 	status = tempTable.Flush()
 	if everFailed || status != st.OK {
-		return st.FailedToCopyCertainRows
+		return discard(st.From(st.FailedToCopyCertainRows, tempTable.Err()))
+	}
+	tempTable.Close()
+	// Row numbers are changed, indexes will be re-created.
+	indexed := make([]string, 0)
+	for columnName, _ := range table.Indexes {
+		indexed = append(indexed[:], columnName)
 	}
+	table.closeFiles()
 	// Delete the old table (one that is rebuilt), and rename the temporary 
 	// table to the name of the rebuilt table.
-	status = tablefilemanager.Delete(table.Path, table.Name)
-	if status == st.OK {
-		status = tablefilemanager.Rename(table.Path, tempName, table.Name)
-		if status == st.OK {
-			// Files have been changed, thus re-open file handles.
-			return table.OpenFiles()
-		}
+	e := tablefilemanager.Delete(table.Path, table.Name)
+	if e == nil {
+		e = tablefilemanager.Rename(table.Path, tempName, table.Name)
+	}
+	// Files have been closed (and changed), thus reload the table.
+	if loaded := table.load(); loaded != st.OK {
+		return loaded
+	}
+	if rebuilt := table.rebuildIndexes(indexed); rebuilt != st.OK {
+		return rebuilt
+	}
+	if e != nil {
+		return table.fail(e)
 	}
 	return st.OK
 }
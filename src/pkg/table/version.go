@@ -0,0 +1,94 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/*
+Row versions of multi-version tables.
+
+A table having special columns ~creator and ~deleter keeps multiple versions of a row: a new version
+is inserted at the bottom of the table, and the old version is marked deleted (~del) with the ID of the
+replacing transaction in ~deleter. Rows are never overwritten by versions, readers of a snapshot (see
+package snapshot) may read old versions while the row is being changed. Old versions are removed when
+the data file is rebuilt, if no snapshot sees them.
+*/
+
+package table
+
+import (
+	"constant"
+	"st"
+)
+
+// Returns true if the table keeps multiple versions of rows.
+func (table *Table) Versioned() bool {
+	_, hasCreator := table.Columns["~creator"]
+	_, hasDeleter := table.Columns["~deleter"]
+	return hasCreator && hasDeleter
+}
+
+// Makes the table keep multiple versions of rows by adding columns ~creator and ~deleter, existing rows
+// are seen by all snapshots. If the table has rows, its data file is rebuilt (see RebuildDataFile).
+func (table *Table) AddVersions() int {
+	for name, length := range constant.VersionColumns() {
+		if _, exists := table.Columns[name]; exists {
+			continue
+		}
+		status := table.Add(name, length)
+		if status != st.OK {
+			return status
+		}
+	}
+	return st.OK
+}
+
+// Replaces a row by a new version created by the transaction, the new version has the values of the
+// row updated by the given values. The new version is written into a reserved row (see Reserve).
+func (table *Table) NewVersion(rowNumber int, row map[string]string, transactionID string, into int) int {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	if !table.Versioned() {
+		return table.fail(st.New(st.TableIsNotVersioned))
+	}
+	if _, status := table.rowOffset(rowNumber); status != st.OK {
+		return status
+	}
+	if _, status := table.rowOffset(into); status != st.OK {
+		return status
+	}
+	// Validate all values before writing anything.
+	if _, status := table.encode(row); status != st.OK {
+		return status
+	}
+	version, status := table.read(rowNumber)
+	if status != st.OK {
+		return status
+	}
+	if version["~del"] == "y" {
+		return table.fail(st.New(st.RowIsDeleted).WithRow(rowNumber))
+	}
+	for name, value := range row {
+		version[name] = value
+	}
+	version["~creator"] = transactionID
+	version["~deleter"] = ""
+	// Mark the old version deleted first, so that the row is never live in two versions.
+	status = table.update(rowNumber, map[string]string{"~del": "y", "~deleter": transactionID})
+	if status != st.OK {
+		return status
+	}
+	return table.update(into, version)
+}
@@ -16,28 +16,32 @@ You should have received a copy of the GNU General Public License
 along with this program.  If not, see <http://www.gnu.org/licenses/>.
 */
 
-/* Manage table files, handles creation/renaming/removing of table files. */
+/*
+Manage table files, handles creation/renaming/removing of table files.
+Functions return nil if they succeed, otherwise an error naming the table and wrapping the OS error.
+*/
 
 package tablefilemanager
 
 import (
 	"os"
+	"path/filepath"
 	"constant"
 	"logg"
 	"st"
 )
 
 // Creates table files.
-func Create(path string, name string) int {
+func Create(path string, name string) *st.Error {
 	if len(name) > constant.MaxTableNameLength {
-		return st.TableNameTooLong
+		return st.New(st.TableNameTooLong).WithTable(name)
 	}
 	// Create table files with extension names.
 	for _, ext := range constant.TableFiles() {
 		_, err := os.Create(path + name + ext)
 		if err != nil {
 			logg.Err("tablefilemanager", "Create", err)
-			return st.CannotCreateTableFile
+			return st.Wrap(st.CannotCreateTableFile, err).WithTable(name)
 		}
 	}
 	// Create table directories with name suffixes.
@@ -45,46 +49,72 @@ func Create(path string, name string) int {
 		err := os.Mkdir(path+name+dir, constant.TableDirPerm)
 		if err != nil {
 			logg.Err("tablefilemanager", "Create", err)
-			return st.CannotCreateTableDir
+			return st.Wrap(st.CannotCreateTableDir, err).WithTable(name)
 		}
 	}
-	return st.OK
+	return nil
 }
 
 // Renames table files.
-func Rename(path string, oldName string, newName string) int {
+func Rename(path string, oldName string, newName string) *st.Error {
 	for _, ext := range constant.TableFiles() {
 		err := os.Rename(path+oldName+ext, path+newName+ext)
 		if err != nil {
 			logg.Err("tablefilemanager", "Rename", err)
-			return st.CannotRenameTableFile
+			return st.Wrap(st.CannotRenameTableFile, err).WithTable(oldName)
 		}
 	}
 	for _, dir := range constant.TableDirs() {
 		err := os.Rename(path+oldName+dir, path+newName+dir)
 		if err != nil {
 			logg.Err("tablefilemanager", "Rename", err)
-			return st.CannotRenameTableDir
+			return st.Wrap(st.CannotRenameTableDir, err).WithTable(oldName)
+		}
+	}
+	// Rename index files (oldName.COLUMN.idx).
+	indexFiles, err := filepath.Glob(path + oldName + ".*" + constant.IndexFileExtension)
+	if err != nil {
+		logg.Err("tablefilemanager", "Rename", err)
+		return st.Wrap(st.CannotRenameTableFile, err).WithTable(oldName)
+	}
+	for _, indexFile := range indexFiles {
+		err = os.Rename(indexFile, path+newName+indexFile[len(path+oldName):])
+		if err != nil {
+			logg.Err("tablefilemanager", "Rename", err)
+			return st.Wrap(st.CannotRenameTableFile, err).WithTable(oldName)
 		}
 	}
-	return st.OK
+	return nil
 }
 
 // Deletes table files
-func Delete(path string, name string) int {
+func Delete(path string, name string) *st.Error {
 	for _, ext := range constant.TableFiles() {
 		err := os.Remove(path + name + ext)
 		if err != nil {
 			logg.Err("tablefilemanager", "Delete", err)
-			return st.CannotRemoveTableFile
+			return st.Wrap(st.CannotRemoveTableFile, err).WithTable(name)
 		}
 	}
 	for _, dir := range constant.TableDirs() {
 		err := os.RemoveAll(path + name + dir)
 		if err != nil {
 			logg.Err("tablefilemanager", "Delete", err)
-			return st.CannotRemoveTableDir
+			return st.Wrap(st.CannotRemoveTableDir, err).WithTable(name)
+		}
+	}
+	// Delete index files (name.COLUMN.idx).
+	indexFiles, err := filepath.Glob(path + name + ".*" + constant.IndexFileExtension)
+	if err != nil {
+		logg.Err("tablefilemanager", "Delete", err)
+		return st.Wrap(st.CannotRemoveTableFile, err).WithTable(name)
+	}
+	for _, indexFile := range indexFiles {
+		err = os.Remove(indexFile)
+		if err != nil {
+			logg.Err("tablefilemanager", "Delete", err)
+			return st.Wrap(st.CannotRemoveTableFile, err).WithTable(name)
 		}
 	}
-	return st.OK
+	return nil
 }
@@ -35,12 +35,23 @@ type UndoDelete struct {
 	RowNumber int
 }
 
-// An insert operation is undone by marking the inserted row deleted.
+// A delete operation is undone by marking the deleted row not deleted.
 func (u *UndoDelete) Undo() int {
-	return u.Table.Update(u.RowNumber, map[string]string{"~del": ""})
+	return u.Table.Update(u.RowNumber, map[string]string{"~del": "", "~deleter": ""})
 }
 
+// Deletes a row, the table is locked in intention exclusive mode and the row exclusively.
 func (tr *Transaction) Delete(t *table.Table, rowNumber int) int {
+	tr.err = nil
+	return tr.failed(tr.delete(t, rowNumber), t, rowNumber)
+}
+
+// Deletes a row, see Delete.
+func (tr *Transaction) delete(t *table.Table, rowNumber int) int {
+	status := tr.ELockRow(t, rowNumber)
+	if status != st.OK {
+		return status
+	}
 	// Execute "before delete" triggers.
 	beforeTable, status := tr.DB.Get("~before")
 	if status != st.OK {
@@ -50,6 +61,10 @@ func (tr *Transaction) Delete(t *table.Table, rowNumber int) int {
 	if status != st.OK {
 		return status
 	}
+	// A deleted version of a multi-version table keeps its deleter.
+	if t.Versioned() && row["~del"] == "y" {
+		return st.RowIsDeleted
+	}
 	triggerRA := ra.New()
 	_, status = triggerRA.Load(beforeTable)
 	if status != st.OK {
@@ -63,8 +78,23 @@ func (tr *Transaction) Delete(t *table.Table, rowNumber int) int {
 	if status != st.OK {
 		return status
 	}
-	// Update the row.
-	status = t.Delete(rowNumber)
+	status = tr.write(t)
+	if status != st.OK {
+		return status
+	}
+	// Write ahead the undo record.
+	if e := tr.DB.Log.Delete(tr.ID, t.Name, rowNumber); e != nil {
+		tr.err = e
+		return e.Code
+	}
+	// Delete the row, a version of multi-version table remains for snapshots which see it.
+	if t.Versioned() {
+		status = t.Update(rowNumber, map[string]string{"~del": "y", "~deleter": tr.versionID()})
+	} else {
+		status = t.Delete(rowNumber)
+	}
+	// The row may have been marked deleted even if deleting failed.
+	tr.Log(&UndoDelete{t, rowNumber})
 	if status != st.OK {
 		return status
 	}
@@ -82,11 +112,5 @@ func (tr *Transaction) Delete(t *table.Table, rowNumber int) int {
 	if status != st.OK {
 		return status
 	}
-	status = trigger.ExecuteTrigger(tr.DB, t, triggerRA, "DE", row, nil)
-	if status != st.OK {
-		return status
-	}
-	// Log the deleted row.
-	tr.Log(&UndoDelete{t, rowNumber})
-	return st.OK
+	return trigger.ExecuteTrigger(tr.DB, t, triggerRA, "DE", row, nil)
 }
@@ -40,7 +40,33 @@ func (u *UndoInsert) Undo() int {
 	return u.Table.Delete(u.RowNumber)
 }
 
+// Reserves a row at the bottom of the table (see Table.Reserve) for a row written by the transaction,
+// and locks it exclusively. Returns the row number.
+func (tr *Transaction) reserveRow(t *table.Table) (int, int) {
+	// The table is locked first, so that it is not rebuilt while the row is reserved.
+	status := tr.wait(t, NoRow, IntentionExclusive)
+	if status != st.OK {
+		return 0, status
+	}
+	rowNumber, status := t.Reserve()
+	if status != st.OK {
+		return 0, status
+	}
+	return rowNumber, tr.ELockRow(t, rowNumber)
+}
+
+// Inserts a row, the table is locked in intention exclusive mode and the new row exclusively.
 func (tr *Transaction) Insert(t *table.Table, row map[string]string) int {
+	tr.err = nil
+	return tr.failed(tr.insert(t, row), t, -1)
+}
+
+// Inserts a row, see Insert.
+func (tr *Transaction) insert(t *table.Table, row map[string]string) int {
+	if e := t.Check(row); e != nil {
+		tr.err = e
+		return e.Code
+	}
 	// Execute "before insert" triggers.
 	beforeTable, status := tr.DB.Get("~before")
 	if status != st.OK {
@@ -60,11 +86,33 @@ func (tr *Transaction) Insert(t *table.Table, row map[string]string) int {
 		return status
 	}
 	// Insert the new row to table.
-	numberOfRows, status := t.NumberOfRows()
+	numberOfRows, status := tr.reserveRow(t)
 	if status != st.OK {
 		return status
 	}
-	status = t.Insert(row)
+	status = tr.write(t)
+	if status != st.OK {
+		return status
+	}
+	// Write ahead the undo record.
+	if e := tr.DB.Log.Insert(tr.ID, t.Name, numberOfRows); e != nil {
+		tr.err = e
+		return e.Code
+	}
+	// Write the row into the reserved row.
+	values := make(map[string]string)
+	for name, value := range row {
+		values[name] = value
+	}
+	values["~del"] = ""
+	if t.Versioned() {
+		// The new row is a version created by the transaction.
+		values["~creator"] = tr.versionID()
+	}
+	status = t.Update(numberOfRows, values)
+	// The row may have been written even if writing failed (e.g. it cannot be put into an index),
+	// it is undone by rollback. After triggers are undone by rollback as well.
+	tr.Log(&UndoInsert{t, numberOfRows})
 	if status != st.OK {
 		return status
 	}
@@ -82,11 +130,5 @@ func (tr *Transaction) Insert(t *table.Table, row map[string]string) int {
 	if status != st.OK {
 		return status
 	}
-	status = trigger.ExecuteTrigger(tr.DB, t, triggerRA, "IN", row, nil)
-	if status != st.OK {
-		return status
-	}
-	// Log the inserted row.
-	tr.Log(&UndoInsert{t, numberOfRows})
-	return st.OK
+	return trigger.ExecuteTrigger(tr.DB, t, triggerRA, "IN", row, nil)
 }
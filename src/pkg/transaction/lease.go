@@ -0,0 +1,184 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/*
+Leases of table and row locks.
+A lock file holds the lease of its owner and the lock mode:
+  ID PID HOST DEADLINE MODE
+ID is the transaction ID, PID and HOST identify the process running the transaction, DEADLINE (in
+nanoseconds) is when the lock expires unless the owner renews the lease. MODE is one of IS, IX, S and X,
+lock files without MODE are shared or exclusive locks of the table.
+Leases are renewed when the transaction locks, reads and writes tables, and before it commits.
+Expired locks, and locks owned by processes which no longer run on this host, are reclaimed (removed)
+by LocksOf. Lock files of older versions (exclusive lock file holding only the transaction ID, empty
+shared lock file) expire LockTimeout after the transaction began.
+Lock files are written to a temporary file first and renamed, readers never see partial leases.
+Lock files which cannot be parsed are held by an unknown transaction until LockTimeout after they
+were last modified.
+*/
+
+package transaction
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"constant"
+	"st"
+	"util"
+	"logg"
+)
+
+type Lease struct {
+	ID       int64 // transaction ID
+	PID      int   // 0 if unknown
+	Host     string
+	Deadline int64
+	Mode     int // 0 if unknown
+}
+
+// Returns a new lease of the transaction's locks.
+func newLease(id int64) *Lease {
+	return &Lease{id, os.Getpid(), util.Hostname(), time.Nanoseconds() + constant.LockTimeout, 0}
+}
+
+// Returns the content of lock file.
+func (lease *Lease) String() string {
+	return strconv.Itoa64(lease.ID) + " " + strconv.Itoa(lease.PID) + " " + lease.Host + " " +
+		strconv.Itoa64(lease.Deadline) + modeSuffix(lease.Mode)
+}
+
+// Returns the lock mode to be written after a lease.
+func modeSuffix(mode int) string {
+	if mode == 0 {
+		return ""
+	}
+	return " " + modeNames[mode]
+}
+
+// Returns true if the lease has expired or its owner process is dead.
+func (lease *Lease) Expired() bool {
+	if time.Nanoseconds() > lease.Deadline {
+		return true
+	}
+	return lease.PID != 0 && util.Hostname() != "" && lease.Host == util.Hostname() && !util.Alive(lease.PID)
+}
+
+// Returns the lease of a lock file which cannot be parsed, held by unknown transaction (ID 0) until
+// LockTimeout after the file was last modified. Returns nil if the file is gone.
+func malformedLease(path string) *Lease {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	return &Lease{Deadline: fi.Mtime_ns + constant.LockTimeout}
+}
+
+// Reads the lease in a lock file. The name is the transaction ID if the file has no content (older version).
+// Returns nil lease if the file is gone (lock released meanwhile).
+func readLease(path, name string) *Lease {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	fields := strings.Fields(string(content))
+	switch len(fields) {
+	case 0, 1:
+		// Older version, the transaction ID is a timestamp.
+		if len(fields) == 1 {
+			name = fields[0]
+		}
+		id, err := strconv.Atoi64(name)
+		if err != nil {
+			return malformedLease(path)
+		}
+		return &Lease{ID: id, Deadline: id + constant.LockTimeout}
+	case 4, 5:
+		lease := &Lease{Host: fields[2]}
+		var err1, err2, err3 os.Error
+		lease.ID, err1 = strconv.Atoi64(fields[0])
+		lease.PID, err2 = strconv.Atoi(fields[1])
+		lease.Deadline, err3 = strconv.Atoi64(fields[3])
+		if len(fields) == 5 {
+			for mode, name := range modeNames {
+				if name == fields[4] {
+					lease.Mode = mode
+				}
+			}
+			if lease.Mode == 0 {
+				return malformedLease(path)
+			}
+		}
+		if err1 == nil && err2 == nil && err3 == nil {
+			return lease
+		}
+	}
+	return malformedLease(path)
+}
+
+// Removes a lock file whose lease has expired.
+// Returns false if the file cannot be removed (it is fine if another process has removed it).
+func reclaim(path string, lease *Lease) bool {
+	logg.Warn("transaction", "reclaim", "Expired lock of transaction "+strconv.Itoa64(lease.ID)+
+		" (process "+strconv.Itoa(lease.PID)+" on "+lease.Host+") file "+path+" is removed")
+	err := os.Remove(path)
+	if err != nil {
+		if _, err = os.Stat(path); err == nil {
+			logg.Err("transaction", "reclaim", err)
+			return false
+		}
+	}
+	return true
+}
+
+// Renews the leases of the transaction's locks.
+// Returns LockExpired if a lock has expired and been reclaimed by another transaction.
+func (tr *Transaction) Renew() int {
+	deadline := newLease(tr.id).Deadline
+	for _, t := range tr.Locked {
+		// Locks which are only in memory do not expire.
+		h, onDisk := tr.holdingOf(t)
+		if !onDisk {
+			continue
+		}
+		existingLocks, status := fileHoldings(t)
+		if status != st.OK {
+			return status
+		}
+		if _, exists := existingLocks[tr.id]; !exists {
+			logg.Err("transaction", "Renew", "Transaction "+tr.ID+" lost its lock on "+t.Name)
+			return st.LockExpired
+		}
+		status = tr.fileLock(t, h)
+		if status != st.OK {
+			return status
+		}
+	}
+	tr.leaseDeadline = deadline
+	return st.OK
+}
+
+// Renews the leases if half of the lease time has passed.
+func (tr *Transaction) renewIfDue() int {
+	if len(tr.Locked) == 0 || time.Nanoseconds() < tr.leaseDeadline-constant.LockTimeout/2 {
+		return st.OK
+	}
+	return tr.Renew()
+}
@@ -16,14 +16,33 @@ You should have received a copy of the GNU General Public License
 along with this program.  If not, see <http://www.gnu.org/licenses/>.
 */
 
-/* Exclusive, shared table locks, unlocking. */
+/*
+Exclusive, shared table locks, row locks, unlocking.
+
+A table is locked in one of four modes. Shared (S) and exclusive (X) locks cover the whole table,
+intention shared (IS) and intention exclusive (IX) locks are taken before locking rows of the table
+in shared or exclusive mode. Compatible modes are:
+      IS  IX  S   X
+  IS  y   y   y   -
+  IX  y   y   -   -
+  S   y   -   y   -
+  X   -   -   -   -
+Rows are locked in shared or exclusive mode, shared row locks are compatible with each other.
+
+Lock files are used while other processes may hold the database:
+tableName.exclusive - exclusive table lock.
+tableName.shared/ID - table lock of transaction ID in S, IS or IX mode.
+tableName.shared/ID.ROW - lock of row number ROW by transaction ID.
+Each file holds the lease of the lock (see lease.go) followed by the mode. Files whose names contain
+ThePrefix are being written and are ignored.
+*/
 
 package transaction
 
 import (
 	"os"
 	"strconv"
-	"time"
+	"strings"
 	"constant"
 	"table"
 	"st"
@@ -31,13 +50,132 @@ import (
 	"logg"
 )
 
+// Lock modes.
+const (
+	IntentionShared = iota + 1
+	IntentionExclusive
+	Shared
+	Exclusive
+)
+
+// Row number of table locks.
+const NoRow = -1
+
+// Names of lock modes in lock files.
+var modeNames = map[int]string{IntentionShared: "IS", IntentionExclusive: "IX", Shared: "S", Exclusive: "X"}
+
+// Returns true if a lock in mode1 and another transaction's lock in mode2 may be held at the same time.
+func compatible(mode1, mode2 int) bool {
+	switch mode1 {
+	case IntentionShared:
+		return mode2 != Exclusive
+	case IntentionExclusive:
+		return mode2 == IntentionShared || mode2 == IntentionExclusive
+	case Shared:
+		return mode2 == IntentionShared || mode2 == Shared
+	}
+	return false
+}
+
+// Returns the table lock mode after a transaction holding a mode requests another.
+// A shared lock replaces an exclusive lock (downgrade), other requests keep the stronger mode.
+func resulting(held, requested int) int {
+	switch {
+	case held == 0 || held == requested:
+		return requested
+	case held == Exclusive && requested == Shared:
+		return Shared
+	case requested == IntentionShared:
+		return held
+	case held == IntentionShared && (requested == IntentionExclusive || requested == Shared):
+		return requested
+	}
+	// Exclusive covers shared together with intention exclusive.
+	return Exclusive
+}
+
+// Returns the status of failing to lock in a mode.
+func conflictStatus(mode int) int {
+	if mode == Shared || mode == IntentionShared {
+		return st.CannotLockInShared
+	}
+	return st.CannotLockInExclusive
+}
+
+// Locks held by a transaction on a table.
+type holding struct {
+	mode int         // table lock mode, 0 if the table is not locked
+	rows map[int]int // row number -> Shared or Exclusive
+}
+
+// Returns a copy of the holding.
+func (h *holding) copy() *holding {
+	rows := make(map[int]int)
+	for row, mode := range h.rows {
+		rows[row] = mode
+	}
+	return &holding{h.mode, rows}
+}
+
+// Returns true if the holding has exclusive row locks.
+func (h *holding) writesRows() bool {
+	for _, mode := range h.rows {
+		if mode == Exclusive {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the transactions among the holders whose locks conflict with a lock requested by a transaction.
+func conflicts(held map[int64]*holding, id int64, row, mode int) []int64 {
+	ids := make([]int64, 0)
+	for other, h := range held {
+		if other == id {
+			continue
+		}
+		if row == NoRow {
+			if h.mode != 0 && !compatible(h.mode, mode) {
+				ids = append(ids, other)
+			}
+		} else if rowMode, locked := h.rows[row]; locked && !compatible(rowMode, mode) {
+			ids = append(ids, other)
+		}
+	}
+	return ids
+}
+
 type Locks struct {
 	Shared    []int64
 	Exclusive int64
+	Intention map[int64]int         // intention locks (IntentionShared or IntentionExclusive) by transaction
+	Rows      map[int]map[int64]int // row locks (Shared or Exclusive) by row number and transaction
+}
+
+// Returns the locks of the holders.
+func locksFrom(held map[int64]*holding) *Locks {
+	locks := &Locks{make([]int64, 0), 0, make(map[int64]int), make(map[int]map[int64]int)}
+	for id, h := range held {
+		switch h.mode {
+		case Exclusive:
+			locks.Exclusive = id
+		case Shared:
+			locks.Shared = append(locks.Shared[:], id)
+		case IntentionShared, IntentionExclusive:
+			locks.Intention[id] = h.mode
+		}
+		for row, mode := range h.rows {
+			if locks.Rows[row] == nil {
+				locks.Rows[row] = make(map[int64]int)
+			}
+			locks.Rows[row][id] = mode
+		}
+	}
+	return locks
 }
 
-// Returns existing shared and exclusive locks of a table.
-func LocksOf(t *table.Table) (*Locks, int) {
+// Returns the locks of a table in lock files by transaction, expired locks are reclaimed.
+func fileHoldings(t *table.Table) (map[int64]*holding, int) {
 	// Read files in .shared directory.
 	sharedLocksPath := t.Path + t.Name + ".shared"
 	sharedLocksDir, err := os.Open(sharedLocksPath)
@@ -47,133 +185,152 @@ func LocksOf(t *table.Table) (*Locks, int) {
 	defer sharedLocksDir.Close()
 	fi, err := sharedLocksDir.Readdir(0)
 	if err != nil {
-		logg.Err("transaction", "LocksOf", err)
+		logg.Err("transaction", "fileHoldings", err)
 		return nil, st.CannotReadSharedLocksDir
 	}
-	locks := new(Locks)
-	locks.Shared = make([]int64, 0)
+	held := make(map[int64]*holding)
+	holdingOf := func(id int64) *holding {
+		h, exists := held[id]
+		if !exists {
+			h = &holding{0, make(map[int]int)}
+			held[id] = h
+		}
+		return h
+	}
 	for _, fileInfo := range fi {
-		// File name represents a transaction ID (also a timestamp).
-		theID, err := strconv.Atoi64(fileInfo.Name)
-		if err != nil || theID > time.Nanoseconds()+constant.LockTimeout {
-			// Remove expired shared lock.
-			err = os.Remove(sharedLocksPath + "/" + fileInfo.Name)
-			logg.Warn("transaction", "LocksOf", "Expired shared lock ID "+
-				fileInfo.Name+" file "+sharedLocksPath+"/"+fileInfo.Name+" is removed")
-			if err != nil {
-				logg.Err("transaction", "LocksOf", err)
+		// File name represents a transaction ID and optionally a row number, content is the lease.
+		if strings.Contains(fileInfo.Name, constant.ThePrefix) {
+			continue
+		}
+		lockPath := sharedLocksPath + "/" + fileInfo.Name
+		idRow := strings.SplitN(fileInfo.Name, ".", 2)
+		lease := readLease(lockPath, idRow[0])
+		if lease == nil {
+			continue
+		}
+		if lease.Expired() {
+			if !reclaim(lockPath, lease) {
 				return nil, st.CannotUnlockSharedLock
 			}
-		} else {
-			locks.Shared = append(locks.Shared[:], theID)
+			continue
+		}
+		mode := lease.Mode
+		if mode == 0 {
+			mode = Shared
+		}
+		if len(idRow) == 1 {
+			holdingOf(lease.ID).mode = mode
+		} else if row, err := strconv.Atoi(idRow[1]); err == nil {
+			holdingOf(lease.ID).rows[row] = mode
 		}
 	}
-	// Read the content of exclusive lock.
+	// Read the lease in exclusive lock file.
 	exclusiveLockPath := t.Path + t.Name + ".exclusive"
-	exclusiveFile, err := os.Open(exclusiveLockPath)
-	if err != nil {
-		return locks, st.OK
+	lease := readLease(exclusiveLockPath, "")
+	if lease == nil {
+		return held, st.OK
 	}
-	fi2, err := exclusiveFile.Stat()
-	if err != nil {
-		logg.Err("transaction", "LocksOf", err)
-		return nil, st.CannotReadExclusiveLocksFile
-	}
-	// The file content is a transaction ID
-	buffer := make([]byte, fi2.Size)
-	_, err = exclusiveFile.Read(buffer)
-	if err != nil {
-		logg.Err("transaction", "LocksOf", err)
-		return nil, st.CannotReadExclusiveLocksFile
-	}
-	theID, err := strconv.Atoi64(string(buffer))
-	if err != nil || theID > time.Nanoseconds()+constant.LockTimeout {
-		// Remove expired exclusive lock.
-		err = os.Remove(exclusiveLockPath)
-		logg.Debug("transaction", "LocksOf", err)
-		logg.Warn("transaction", "LocksOf", "Expired exclusive lock ID "+
-			string(buffer)+" file "+exclusiveLockPath+" is removed")
-		if err != nil {
-			logg.Err("transaction", "LocksOf", err)
+	if lease.Expired() {
+		if !reclaim(exclusiveLockPath, lease) {
 			return nil, st.CannotUnlockExclusiveLock
 		}
 	} else {
-		locks.Exclusive = theID
+		holdingOf(lease.ID).mode = Exclusive
 	}
-	return locks, st.OK
+	return held, st.OK
 }
 
-// Locks a table in exclusive mode.
+// Locks a table in exclusive mode, waits for conflicting locks to be released.
 func (tr *Transaction) ELock(t *table.Table) int {
-	existingLocks, status := LocksOf(t)
+	return tr.failed(tr.wait(t, NoRow, Exclusive), t, -1)
+}
+
+// Locks a table in shared mode, waits for conflicting locks to be released.
+// An exclusive lock held by the transaction is downgraded, unless it has locked rows exclusively.
+func (tr *Transaction) SLock(t *table.Table) int {
+	return tr.failed(tr.wait(t, NoRow, Shared), t, -1)
+}
+
+// Locks a row in exclusive mode, the table is locked in intention exclusive mode first.
+func (tr *Transaction) ELockRow(t *table.Table, rowNumber int) int {
+	status := tr.wait(t, NoRow, IntentionExclusive)
+	if status == st.OK {
+		status = tr.wait(t, rowNumber, Exclusive)
+	}
+	return tr.failed(status, t, rowNumber)
+}
+
+// Locks a row in shared mode, the table is locked in intention shared mode first.
+func (tr *Transaction) SLockRow(t *table.Table, rowNumber int) int {
+	status := tr.wait(t, NoRow, IntentionShared)
+	if status == st.OK {
+		status = tr.wait(t, rowNumber, Shared)
+	}
+	return tr.failed(status, t, rowNumber)
+}
+
+// Writes a lock file of the transaction.
+func (tr *Transaction) createLock(path string, mode int) int {
+	lease := newLease(tr.id)
+	lease.Mode = mode
+	return util.WriteAndRename(path, lease.String())
+}
+
+// Writes the lock files of locks held by the transaction on a table.
+func (tr *Transaction) fileLock(t *table.Table, h *holding) int {
+	status := tr.fileTableLock(t, h.mode)
 	if status != st.OK {
 		return status
 	}
-	// Do not lock if other transaction(s) have shared or exclusively locked the table.
-	if (existingLocks.Exclusive != 0 && existingLocks.Exclusive != tr.id) ||
-		(len(existingLocks.Shared) == 1 && existingLocks.Shared[0] != tr.id) ||
-		(len(existingLocks.Shared) > 1) {
-		return st.CannotLockInExclusive
-	}
-	// Release previously acquired shared lock, if any. 
-	if len(existingLocks.Shared) == 1 && existingLocks.Shared[0] == tr.id {
-		status = tr.unlock(t)
+	for row, mode := range h.rows {
+		status = tr.createLock(t.Path+t.Name+".shared/"+tr.ID+"."+strconv.Itoa(row), mode)
 		if status != st.OK {
 			return status
 		}
 	}
-	// Create exclusive lock file.
-	status = util.CreateAndWrite(t.Path+t.Name+".exclusive", tr.ID)
-	if status != st.OK {
-		return status
-	}
-	tr.Locked = append(tr.Locked[:], t)
 	return st.OK
 }
 
-func (tr *Transaction) SLock(t *table.Table) int {
-	existingLocks, status := LocksOf(t)
-	if status != st.OK {
-		return status
-	}
-	// Do not lock if another transaction has locked the table exclusively.
-	if existingLocks.Exclusive != 0 && existingLocks.Exclusive != tr.id {
-		return st.CannotLockInShared
-	}
-	// Release previously acquired exclusive lock, if any.
-	if existingLocks.Exclusive == tr.id {
-		status = tr.unlock(t)
-		if status != st.OK {
-			return status
+// Replaces the table lock file of the transaction by one in a mode.
+func (tr *Transaction) fileTableLock(t *table.Table, mode int) int {
+	exclusiveLockPath := t.Path + t.Name + ".exclusive"
+	if mode != Exclusive {
+		if lease := readLease(exclusiveLockPath, ""); lease != nil && lease.ID == tr.id {
+			if err := os.Remove(exclusiveLockPath); err != nil {
+				return st.CannotUnlockExclusiveLock
+			}
 		}
 	}
-	// Create shared lock file.
-	status = util.CreateAndWrite(t.Path+t.Name+".shared/"+tr.ID, "")
-	if status != st.OK {
-		return status
+	if mode == Exclusive {
+		os.Remove(t.Path + t.Name + ".shared/" + tr.ID)
+		return tr.createLock(exclusiveLockPath, mode)
+	} else if mode != 0 {
+		return tr.createLock(t.Path+t.Name+".shared/"+tr.ID, mode)
 	}
-	tr.Locked = append(tr.Locked[:], t)
 	return st.OK
 }
 
-// Releases locks acquired by this transaction on the table.
-func (tr *Transaction) unlock(t *table.Table) int {
-	existingLocks, status := LocksOf(t)
+// Removes lock files of this transaction on the table.
+func (tr *Transaction) fileUnlock(t *table.Table) int {
+	status := tr.fileTableLock(t, 0)
 	if status != st.OK {
 		return status
 	}
-	// Release exclusive lock by deleting the exclusive lock file.
-	if existingLocks.Exclusive == tr.id {
-		err := os.Remove(t.Path + t.Name + ".exclusive")
-		if err != nil {
-			return st.CannotUnlockExclusiveLock
-		}
-		return st.OK
+	// Remove table lock and row locks in shared directory.
+	sharedLocksPath := t.Path + t.Name + ".shared"
+	sharedLocksDir, err := os.Open(sharedLocksPath)
+	if err != nil {
+		return st.CannotReadSharedLocksDir
 	}
-	// Release shared lock by deleting the shared lock file.
-	for _, lock := range existingLocks.Shared {
-		if lock == tr.id {
-			err := os.Remove(t.Path + t.Name + ".shared/" + tr.ID)
+	defer sharedLocksDir.Close()
+	fi, err := sharedLocksDir.Readdir(0)
+	if err != nil {
+		logg.Err("transaction", "fileUnlock", err)
+		return st.CannotReadSharedLocksDir
+	}
+	for _, fileInfo := range fi {
+		if fileInfo.Name == tr.ID || strings.HasPrefix(fileInfo.Name, tr.ID+".") {
+			err = os.Remove(sharedLocksPath + "/" + fileInfo.Name)
 			if err != nil {
 				return st.CannotUnlockSharedLock
 			}
@@ -0,0 +1,217 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/*
+In-memory table and row locks.
+Transactions of this process lock tables and rows in memory, which takes no file operation. While other
+processes may hold the database (see database.Registry), locks are also written to lock files, so that
+transactions of all processes see each other's locks; when another process opens the database, the
+in-memory locks are written to lock files before the process goes ahead.
+*/
+
+package transaction
+
+import (
+	"strconv"
+	"sync"
+	"table"
+	"database"
+	"st"
+)
+
+// Locks of a table held by transactions of this process.
+type tableLocks struct {
+	table  *table.Table
+	held   map[int64]*holding
+	onDisk map[int64]bool // holders whose locks are in lock files
+}
+
+var (
+	memoryMutex sync.Mutex
+	memoryLocks = make(map[string]*tableLocks)      // table path and name -> locks
+	registered  = make(map[*database.Registry]bool) // registries told to write locks to files when shared
+)
+
+// Returns the locks of a table, memoryMutex must be held.
+func locksOf(t *table.Table) *tableLocks {
+	locks, exists := memoryLocks[t.Path+t.Name]
+	if !exists {
+		locks = &tableLocks{t, make(map[int64]*holding), make(map[int64]bool)}
+		memoryLocks[t.Path+t.Name] = locks
+	}
+	return locks
+}
+
+// Makes sure that locks of a database's tables are written to files when another process opens it.
+func manage(db *database.Database) {
+	memoryMutex.Lock()
+	if registered[db.Registry] || db.Registry == nil {
+		memoryMutex.Unlock()
+		return
+	}
+	registered[db.Registry] = true
+	memoryMutex.Unlock()
+	db.Registry.OnShare(func() int { return materialize(db.Path) })
+}
+
+// Writes in-memory locks of a database's tables to lock files.
+func materialize(path string) int {
+	memoryMutex.Lock()
+	defer memoryMutex.Unlock()
+	for _, locks := range memoryLocks {
+		if locks.table.Path != path {
+			continue
+		}
+		for id, h := range locks.held {
+			if !locks.onDisk[id] {
+				holder := &Transaction{ID: strconv.Itoa64(id), id: id}
+				status := holder.fileLock(locks.table, h)
+				if status != st.OK {
+					return status
+				}
+				locks.onDisk[id] = true
+			}
+		}
+	}
+	return st.OK
+}
+
+// Returns existing locks of a table, held by transactions of this process or recorded in lock files.
+// Expired lock files are reclaimed.
+func LocksOf(t *table.Table) (*Locks, int) {
+	held, status := fileHoldings(t)
+	if status != st.OK {
+		return nil, status
+	}
+	memoryMutex.Lock()
+	defer memoryMutex.Unlock()
+	if locks, exists := memoryLocks[t.Path+t.Name]; exists {
+		for id, h := range locks.held {
+			held[id] = h
+		}
+	}
+	return locksFrom(held), st.OK
+}
+
+// Remembers a newly locked table, a lease begins with the first lock.
+func (tr *Transaction) locked(t *table.Table) {
+	if tr.holds(t) {
+		return
+	}
+	if len(tr.Locked) == 0 {
+		tr.leaseDeadline = newLease(tr.id).Deadline
+	}
+	tr.Locked = append(tr.Locked[:], t)
+}
+
+// Attempts to lock a table (row is NoRow) or a row in a mode without waiting.
+// Returns the transactions holding conflicting locks if it cannot be locked.
+func (tr *Transaction) tryLock(t *table.Table, row, mode int) ([]int64, int) {
+	memoryMutex.Lock()
+	defer memoryMutex.Unlock()
+	locks := locksOf(t)
+	h, exists := locks.held[tr.id]
+	if !exists {
+		h = &holding{0, make(map[int]int)}
+	}
+	next := h.copy()
+	if row == NoRow {
+		mode = resulting(h.mode, mode)
+		if mode == Shared && h.writesRows() {
+			mode = Exclusive
+		}
+		next.mode = mode
+	} else if held, locked := h.rows[row]; locked && (held == Exclusive || held == mode) {
+		return nil, st.OK
+	} else {
+		next.rows[row] = mode
+	}
+	holders := conflicts(locks.held, tr.id, row, mode)
+	if len(holders) > 0 {
+		return holders, conflictStatus(mode)
+	}
+	if tr.DB.Registry.Shared() {
+		// Transactions of this process are checked already, the others are in lock files.
+		fileHeld, status := fileHoldings(t)
+		if status != st.OK {
+			return nil, status
+		}
+		for id, _ := range locks.held {
+			fileHeld[id] = nil, false
+		}
+		holders = conflicts(fileHeld, tr.id, row, mode)
+		if len(holders) > 0 {
+			return holders, conflictStatus(mode)
+		}
+		if !locks.onDisk[tr.id] {
+			status = tr.fileLock(t, next)
+		} else if row == NoRow {
+			status = tr.fileTableLock(t, mode)
+		} else {
+			status = tr.createLock(t.Path+t.Name+".shared/"+tr.ID+"."+strconv.Itoa(row), mode)
+		}
+		if status != st.OK {
+			return nil, status
+		}
+		locks.onDisk[tr.id] = true
+	} else if locks.onDisk[tr.id] {
+		// Lock files left from when other processes held the database are no longer needed.
+		status := tr.fileUnlock(t)
+		if status != st.OK {
+			return nil, status
+		}
+		locks.onDisk[tr.id] = false, false
+	}
+	locks.held[tr.id] = next
+	tr.locked(t)
+	return nil, st.OK
+}
+
+// Releases locks acquired by this transaction on the table and its rows.
+func (tr *Transaction) unlock(t *table.Table) int {
+	// Runs after memoryMutex is unlocked, waiters lock the table again.
+	defer wakeWaiters()
+	memoryMutex.Lock()
+	defer memoryMutex.Unlock()
+	key := t.Path + t.Name
+	locks, exists := memoryLocks[key]
+	if !exists {
+		return st.OK
+	}
+	locks.held[tr.id] = nil, false
+	status := st.OK
+	if locks.onDisk[tr.id] {
+		status = tr.fileUnlock(t)
+		locks.onDisk[tr.id] = false, false
+	}
+	if len(locks.held) == 0 && len(locks.onDisk) == 0 {
+		memoryLocks[key] = nil, false
+	}
+	return status
+}
+
+// Returns the locks held by the transaction on a table and whether they are in lock files.
+func (tr *Transaction) holdingOf(t *table.Table) (*holding, bool) {
+	memoryMutex.Lock()
+	defer memoryMutex.Unlock()
+	locks, exists := memoryLocks[t.Path+t.Name]
+	if !exists || locks.held[tr.id] == nil {
+		return nil, false
+	}
+	return locks.held[tr.id].copy(), locks.onDisk[tr.id]
+}
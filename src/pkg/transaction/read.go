@@ -0,0 +1,53 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/*
+Reads through a transaction.
+Tables and rows read by a transaction are locked in shared mode, so that other transactions do not
+change them until the transaction ends. Tables which the transaction has locked exclusively are read
+without further locks.
+*/
+
+package transaction
+
+import (
+	"table"
+	"st"
+)
+
+// Locks a table for reading it, in shared mode unless the transaction has locked it exclusively.
+// (SLock would downgrade the exclusive lock)
+func (tr *Transaction) ReadLock(t *table.Table) int {
+	status := tr.renewIfDue()
+	if status != st.OK {
+		return tr.failed(status, t, -1)
+	}
+	if h, _ := tr.holdingOf(t); h != nil && h.mode == Exclusive {
+		return st.OK
+	}
+	return tr.SLock(t)
+}
+
+// Reads a row, the row is locked in shared mode.
+func (tr *Transaction) Read(t *table.Table, rowNumber int) (map[string]string, int) {
+	status := tr.SLockRow(t, rowNumber)
+	if status != st.OK {
+		return nil, status
+	}
+	return t.Read(rowNumber)
+}
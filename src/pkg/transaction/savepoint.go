@@ -0,0 +1,83 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/*
+Savepoints and partial rollback.
+A savepoint marks a position in the list of completed table operations (Done). Rolling back to a
+savepoint undoes the operations done after it, the locks and the operations done before it are kept,
+and so is the savepoint itself. Releasing a savepoint forgets it together with the savepoints set
+after it, the operations are kept. Names may be reused, the latest savepoint of a name is used.
+*/
+
+package transaction
+
+import (
+	"st"
+)
+
+// A named position in the list of completed operations.
+type savepoint struct {
+	name string
+	done int // number of completed operations when the savepoint was set
+}
+
+// Sets a savepoint.
+func (tr *Transaction) Savepoint(name string) int {
+	tr.savepoints = append(tr.savepoints[:], &savepoint{name, len(tr.Done)})
+	return st.OK
+}
+
+// Returns the position of the latest savepoint of the name, or -1 if there is none.
+func (tr *Transaction) savepointOf(name string) int {
+	for i := len(tr.savepoints) - 1; i >= 0; i-- {
+		if tr.savepoints[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Undoes the operations done after the savepoint, the savepoints set after it are forgotten.
+func (tr *Transaction) RollbackTo(name string) int {
+	position := tr.savepointOf(name)
+	if position == -1 {
+		return st.SavepointNotFound
+	}
+	sp := tr.savepoints[position]
+	for i := len(tr.Done) - 1; i >= sp.done; i-- {
+		status := tr.Done[i].Undo()
+		if status != st.OK {
+			// Operations which are not undone remain to be undone by rollback.
+			tr.Done = tr.Done[:i+1]
+			return status
+		}
+	}
+	tr.Done = tr.Done[:sp.done]
+	tr.savepoints = tr.savepoints[:position+1]
+	return st.OK
+}
+
+// Forgets the savepoint and the savepoints set after it, the operations done after it are kept.
+func (tr *Transaction) Release(name string) int {
+	position := tr.savepointOf(name)
+	if position == -1 {
+		return st.SavepointNotFound
+	}
+	tr.savepoints = tr.savepoints[:position]
+	return st.OK
+}
@@ -0,0 +1,158 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package transaction
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"constant"
+	"database"
+	"table"
+	"st"
+)
+
+// Opens a new database in a temporary directory, having an empty table PERSON (NAME).
+func personDatabase(t *testing.T) (*database.Database, *table.Table) {
+	dir, err := ioutil.TempDir("", constant.TemporaryDirPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, status := database.Open(dir + "/")
+	if status != st.OK {
+		t.Fatal(db.Err())
+	}
+	p, status := db.Create("PERSON")
+	if status != st.OK {
+		t.Fatal(db.Err())
+	}
+	if status = p.Add("NAME", 10); status != st.OK {
+		t.Fatal(p.Err())
+	}
+	return db, p
+}
+
+// Returns NAME of the rows which are not deleted.
+func liveNames(t *testing.T, p *table.Table) []string {
+	names := make([]string, 0)
+	numberOfRows, status := p.NumberOfRows()
+	if status != st.OK {
+		t.Fatal(p.Err())
+	}
+	for i := 0; i < numberOfRows; i++ {
+		row, status := p.Read(i)
+		if status != st.OK {
+			t.Fatal(p.Err())
+		}
+		if row["~del"] == "" {
+			names = append(names, row["NAME"])
+		}
+	}
+	return names
+}
+
+func insert(tr *Transaction, p *table.Table, name string) {
+	tr.Insert(p, map[string]string{"NAME": name})
+}
+
+var savepointTests = []struct {
+	name   string
+	change func(tr *Transaction, p *table.Table) int // returns the status of the last operation
+	status int
+	names  []string // names in the table afterwards
+}{
+	{"rollback to savepoint", func(tr *Transaction, p *table.Table) int {
+		insert(tr, p, "BUZZ")
+		tr.Savepoint("s")
+		insert(tr, p, "NIKKI")
+		tr.Update(p, 0, map[string]string{"NAME": "JOSHUA"})
+		return tr.RollbackTo("s")
+	}, st.OK, []string{"BUZZ"}},
+	{"delete is undone", func(tr *Transaction, p *table.Table) int {
+		insert(tr, p, "BUZZ")
+		insert(tr, p, "NIKKI")
+		tr.Savepoint("s")
+		tr.Delete(p, 0)
+		return tr.RollbackTo("s")
+	}, st.OK, []string{"BUZZ", "NIKKI"}},
+	{"savepoint is kept", func(tr *Transaction, p *table.Table) int {
+		insert(tr, p, "BUZZ")
+		tr.Savepoint("s")
+		insert(tr, p, "NIKKI")
+		tr.RollbackTo("s")
+		insert(tr, p, "JOSHUA")
+		return tr.RollbackTo("s")
+	}, st.OK, []string{"BUZZ"}},
+	{"latest savepoint of the name", func(tr *Transaction, p *table.Table) int {
+		tr.Savepoint("s")
+		insert(tr, p, "BUZZ")
+		tr.Savepoint("s")
+		insert(tr, p, "NIKKI")
+		return tr.RollbackTo("s")
+	}, st.OK, []string{"BUZZ"}},
+	{"later savepoints are forgotten", func(tr *Transaction, p *table.Table) int {
+		tr.Savepoint("s1")
+		insert(tr, p, "BUZZ")
+		tr.Savepoint("s2")
+		insert(tr, p, "NIKKI")
+		tr.RollbackTo("s1")
+		return tr.RollbackTo("s2")
+	}, st.SavepointNotFound, []string{}},
+	{"released savepoint", func(tr *Transaction, p *table.Table) int {
+		tr.Savepoint("s")
+		insert(tr, p, "BUZZ")
+		tr.Release("s")
+		return tr.RollbackTo("s")
+	}, st.SavepointNotFound, []string{"BUZZ"}},
+	{"release keeps earlier savepoints and changes", func(tr *Transaction, p *table.Table) int {
+		tr.Savepoint("s1")
+		insert(tr, p, "BUZZ")
+		tr.Savepoint("s2")
+		insert(tr, p, "NIKKI")
+		tr.Release("s2")
+		return tr.RollbackTo("s1")
+	}, st.OK, []string{}},
+	{"unknown savepoint", func(tr *Transaction, p *table.Table) int {
+		insert(tr, p, "BUZZ")
+		return tr.Release("s")
+	}, st.SavepointNotFound, []string{"BUZZ"}},
+}
+
+func TestRollbackTo(t *testing.T) {
+	for _, test := range savepointTests {
+		db, p := personDatabase(t)
+		tr := New(db)
+		if status := test.change(tr, p); status != test.status {
+			t.Errorf("%s: status is %d, want %d", test.name, status, test.status)
+		}
+		if names := liveNames(t, p); fmt.Sprint(names) != fmt.Sprint(test.names) {
+			t.Errorf("%s: rows are %v, want %v", test.name, names, test.names)
+		}
+		// Changes kept after rolling back to a savepoint are committed.
+		if status := tr.Commit(); status != st.OK {
+			t.Errorf("%s: Commit returned %s", test.name, tr.Err())
+		}
+		if names := liveNames(t, p); fmt.Sprint(names) != fmt.Sprint(test.names) {
+			t.Errorf("%s: rows are %v after commit, want %v", test.name, names, test.names)
+		}
+		db.Close()
+		os.RemoveAll(db.Path)
+	}
+}
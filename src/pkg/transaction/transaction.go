@@ -21,10 +21,12 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package transaction
 
 import (
+	"constant"
 	"table"
 	"database"
 	"time"
 	"strconv"
+	"snapshot"
 	"st"
 )
 
@@ -34,17 +36,56 @@ type Undoable interface {
 }
 
 type Transaction struct {
-	DB     *database.Database
-	Done   []Undoable // completed table operations (insert, update, delete)
-	ID     string     // transaction ID as string
-	id     int64      // identical to ID, but in int type
-	Locked []*table.Table
+	DB      *database.Database
+	Done    []Undoable // completed table operations (insert, update, delete)
+	ID      string     // transaction ID as string
+	id      int64      // identical to ID, but in int type
+	Locked  []*table.Table
+	Written []*table.Table // tables changed by the transaction
+	// Nanoseconds to wait for a table lock held by other transactions, 0 to fail immediately.
+	LockTimeout   int64
+	leaseDeadline int64 // when the earliest lease of the transaction's locks expires
+	writeID       int64 // ID carried by row versions of the transaction (see package snapshot), 0 before it writes
+	savepoints    []*savepoint
+	err           *st.Error // error of the latest failed operation
 }
 
 // Returns a new and ready Transaction.
 func New(db *database.Database) *Transaction {
 	theID := time.Nanoseconds()
-	return &Transaction{db, make([]Undoable, 0), strconv.Itoa64(theID), theID, make([]*table.Table, 0)}
+	manage(db)
+	return &Transaction{db, make([]Undoable, 0), strconv.Itoa64(theID), theID, make([]*table.Table, 0), make([]*table.Table, 0),
+		constant.LockWaitTimeout, 0, 0, make([]*savepoint, 0), nil}
+}
+
+// Returns the error of the latest failed operation (insert, update, delete, commit or rollback) with the
+// table, column and row involved and the underlying error, or nil if the latest operation succeeded.
+func (tr *Transaction) Err() *st.Error {
+	return tr.err
+}
+
+// Remembers the error of an operation on a row of a table (-1 if the row is unknown) which ends in the status.
+// An error of the status recorded during the operation, by the transaction or the table, is kept as it may
+// tell more. Returns the status.
+func (tr *Transaction) failed(status int, t *table.Table, rowNumber int) int {
+	if status == st.OK {
+		tr.err = nil
+		return status
+	}
+	if !tr.err.HasCode(status) {
+		if t != nil {
+			tr.err = st.From(status, t.Err())
+		} else {
+			tr.err = st.New(status)
+		}
+	}
+	if tr.err.Table == "" && t != nil {
+		tr.err.Table = t.Name
+	}
+	if tr.err.Row == -1 {
+		tr.err.Row = rowNumber
+	}
+	return status
 }
 
 // Logs a table operation.
@@ -52,26 +93,118 @@ func (tr *Transaction) Log(undoable Undoable) {
 	tr.Done = append(tr.Done[:], undoable)
 }
 
+// Remembers a table which is about to be changed by the transaction, renews leases of its locks if due.
+func (tr *Transaction) write(t *table.Table) int {
+	status := tr.renewIfDue()
+	if status != st.OK {
+		return status
+	}
+	if tr.writeID == 0 {
+		tr.writeID = snapshot.Begin()
+	}
+	for _, written := range tr.Written {
+		if written == t {
+			return st.OK
+		}
+	}
+	tr.Written = append(tr.Written[:], t)
+	return st.OK
+}
+
+// Returns the ID carried by row versions of the transaction, as string.
+func (tr *Transaction) versionID() string {
+	return strconv.Itoa64(tr.writeID)
+}
+
+// Ends writing row versions, they are seen by snapshots taken from now on.
+func (tr *Transaction) endWrites() {
+	if tr.writeID != 0 {
+		snapshot.End(tr.writeID)
+		tr.writeID = 0
+	}
+}
+
+// Flushes tables changed by the transaction.
+func (tr *Transaction) flushWritten() int {
+	for _, table := range tr.Written {
+		status := table.Flush()
+		if status != st.OK {
+			return status
+		}
+	}
+	tr.Written = make([]*table.Table, 0)
+	return st.OK
+}
+
+// Drops a table which the transaction has locked exclusively, the table is no longer locked afterwards.
+// Dropping cannot be rolled back, thus a table changed by the transaction cannot be dropped before commit.
+func (tr *Transaction) Drop(t *table.Table) int {
+	if h, _ := tr.holdingOf(t); h == nil || h.mode != Exclusive {
+		return tr.failed(st.CannotLockInExclusive, t, -1)
+	}
+	for _, written := range tr.Written {
+		if written == t {
+			return tr.failed(st.TableIsChanged, t, -1)
+		}
+	}
+	status := tr.DB.Drop(t.Name)
+	if status != st.OK {
+		tr.err = st.From(status, tr.DB.Err())
+		return tr.failed(status, t, -1)
+	}
+	// Lock files are removed together with the table, only in-memory locks are left.
+	tr.unlock(t)
+	locked := make([]*table.Table, 0)
+	for _, other := range tr.Locked {
+		if other != t {
+			locked = append(locked[:], other)
+		}
+	}
+	tr.Locked = locked
+	return tr.failed(st.OK, t, -1)
+}
+
 // Commits the transaction and release locked tables.
 func (tr *Transaction) Commit() int {
-	status := int(st.OK)
+	tr.err = nil
+	// Changes must be on disk before the transaction is logged committed.
+	status := tr.flushWritten()
+	if status != st.OK {
+		return tr.failed(status, nil, -1)
+	}
+	// The locks must still be held when the transaction is logged committed.
+	status = tr.Renew()
+	if status != st.OK {
+		return tr.failed(status, nil, -1)
+	}
+	// A transaction which has written has undo records in the log, even if they are rolled back
+	// to a savepoint.
+	if tr.writeID != 0 {
+		if e := tr.DB.Log.Commit(tr.ID); e != nil {
+			tr.err = e
+			return e.Code
+		}
+	}
+	tr.endWrites()
 	for _, table := range tr.Locked {
 		status = table.Flush()
 		if status != st.OK {
-			return status
+			return tr.failed(status, table, -1)
 		}
 		status = tr.unlock(table)
 		if status != st.OK {
-			return status
+			return tr.failed(status, table, -1)
 		}
 	}
 	tr.Locked = make([]*table.Table, 0)
 	tr.Done = make([]Undoable, 0)
+	tr.savepoints = make([]*savepoint, 0)
 	return status
 }
 
 // Rolls back transaction and release locked tables.
 func (tr *Transaction) Rollback() int {
+	tr.err = nil
 	status := int(st.OK)
 	for i := len(tr.Done) - 1; i >= 0; i-- {
 		status = tr.Done[i].Undo()
@@ -79,11 +212,24 @@ func (tr *Transaction) Rollback() int {
 			break
 		}
 	}
+	// Log the rollback only if all changes are undone, otherwise they are undone again in recovery.
+	if status == st.OK {
+		status = tr.flushWritten()
+		if status == st.OK && tr.writeID != 0 {
+			if e := tr.DB.Log.Abort(tr.ID); e != nil {
+				tr.err = e
+				status = e.Code
+			}
+		}
+	}
+	tr.Done = make([]Undoable, 0)
+	tr.endWrites()
 	// Error happening during undo may be more serious than failure of releasing locks.
 	if status == st.OK {
-		status = tr.Commit()
-	} else {
-		tr.Commit()
+		return tr.Commit()
 	}
-	return status
+	failure := tr.err
+	tr.Commit()
+	tr.err = failure
+	return tr.failed(status, nil, -1)
 }
@@ -34,60 +34,132 @@ type UndoUpdate struct {
 	Table     *table.Table
 	RowNumber int
 	Original  map[string]string
+	Version   int // row number of the new version in multi-version table, -1 if updated in place
 }
 
-// An insert operation is undone by marking the inserted row deleted.
+// An update operation is undone by writing back the original values, or by marking the new
+// version deleted and the old version not deleted.
 func (u *UndoUpdate) Undo() int {
-	return u.Table.Update(u.RowNumber, u.Original)
+	if u.Version == -1 {
+		return u.Table.Update(u.RowNumber, u.Original)
+	}
+	// The new version is written into a reserved row, which is already marked deleted if replacing failed.
+	if status := u.Table.Delete(u.Version); status != st.OK {
+		return status
+	}
+	return u.Table.Update(u.RowNumber, map[string]string{"~del": "", "~deleter": ""})
 }
 
+// Replaces a row of multi-version table by a new version, returns the new version's row number.
+func (tr *Transaction) newVersion(t *table.Table, rowNumber int, row, original map[string]string) (int, int) {
+	// Write ahead the undo records, the new version is written into a row reserved at the bottom of the table.
+	numberOfRows, status := tr.reserveRow(t)
+	if status != st.OK {
+		return 0, status
+	}
+	e := tr.DB.Log.Delete(tr.ID, t.Name, rowNumber)
+	if e == nil {
+		e = tr.DB.Log.Insert(tr.ID, t.Name, numberOfRows)
+	}
+	if e != nil {
+		tr.err = e
+		return 0, e.Code
+	}
+	status = t.NewVersion(rowNumber, row, tr.versionID(), numberOfRows)
+	// The old version may have been marked deleted even if replacing failed.
+	tr.Log(&UndoUpdate{t, rowNumber, original, numberOfRows})
+	return numberOfRows, status
+}
+
+// Updates a row, the table is locked in intention exclusive mode and the row exclusively.
+// In multi-version table, the updated row is a new version at the bottom of the table and the row number
+// refers to the old version afterwards (see UpdateVersion).
 func (tr *Transaction) Update(t *table.Table, rowNumber int, row map[string]string) int {
+	_, status := tr.UpdateVersion(t, rowNumber, row)
+	return status
+}
+
+// Updates a row like Update, returns the row number of the updated row, which is the new version
+// in multi-version table.
+func (tr *Transaction) UpdateVersion(t *table.Table, rowNumber int, row map[string]string) (int, int) {
+	tr.err = nil
+	updated, status := tr.update(t, rowNumber, row)
+	return updated, tr.failed(status, t, rowNumber)
+}
+
+// Updates a row, see UpdateVersion.
+func (tr *Transaction) update(t *table.Table, rowNumber int, row map[string]string) (int, int) {
+	if e := t.Check(row); e != nil {
+		tr.err = e
+		return 0, e.Code
+	}
+	status := tr.ELockRow(t, rowNumber)
+	if status != st.OK {
+		return 0, status
+	}
 	// Execute "before update" triggers.
 	beforeTable, status := tr.DB.Get("~before")
 	if status != st.OK {
-		return status
+		return 0, status
 	}
 	original, status := t.Read(rowNumber)
 	if status != st.OK {
-		return status
+		return 0, status
+	}
+	versioned := t.Versioned()
+	if versioned && original["~del"] == "y" {
+		return 0, st.RowIsDeleted
 	}
 	triggerRA := ra.New()
 	_, status = triggerRA.Load(beforeTable)
 	if status != st.OK {
-		return status
+		return 0, status
 	}
 	_, status = triggerRA.Select("TABLE", filter.Eq{}, t.Name)
 	if status != st.OK {
-		return status
+		return 0, status
 	}
 	status = trigger.ExecuteTrigger(tr.DB, t, triggerRA, "UP", row, original)
 	if status != st.OK {
-		return status
+		return 0, status
 	}
-	// Update the row.
-	status = t.Update(rowNumber, row)
+	status = tr.write(t)
 	if status != st.OK {
-		return status
+		return 0, status
+	}
+	updated := rowNumber
+	if versioned {
+		updated, status = tr.newVersion(t, rowNumber, row, original)
+	} else {
+		// Write ahead the undo record.
+		if e := tr.DB.Log.Update(tr.ID, t.Name, rowNumber, original); e != nil {
+			tr.err = e
+			return 0, e.Code
+		}
+		// Update the row, it may have been changed even if updating failed.
+		status = t.Update(rowNumber, row)
+		tr.Log(&UndoUpdate{t, rowNumber, original, -1})
+	}
+	if status != st.OK {
+		return 0, status
 	}
 	// Execute "after update" triggers.
 	afterTable, status := tr.DB.Get("~after")
 	if status != st.OK {
-		return status
+		return 0, status
 	}
 	triggerRA = ra.New()
 	_, status = triggerRA.Load(afterTable)
 	if status != st.OK {
-		return status
+		return 0, status
 	}
 	_, status = triggerRA.Select("TABLE", filter.Eq{}, t.Name)
 	if status != st.OK {
-		return status
+		return 0, status
 	}
 	status = trigger.ExecuteTrigger(tr.DB, t, triggerRA, "UP", row, original)
 	if status != st.OK {
-		return status
+		return 0, status
 	}
-	// Log the updated row.
-	tr.Log(&UndoUpdate{t, rowNumber, original})
-	return st.OK
+	return updated, st.OK
 }
@@ -0,0 +1,221 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/*
+Waiting for table and row locks.
+A transaction which cannot lock a table or a row joins its wait queue, and tries again until:
+- it is ahead of other waiters requesting conflicting modes and the table or row is locked, or
+- its LockTimeout passes (CannotLockInExclusive or CannotLockInShared), or
+- it is the victim of a deadlock (Deadlock), then the transaction should be rolled back by its owner
+  to release its locks.
+Waiters try again as soon as a transaction of this process releases its locks or a waiter leaves its
+queue, and every LockPollInterval for locks held by other processes.
+A transaction changing the mode of its lock on a table is not queued behind other waiters.
+Waiting transactions form a wait-for graph: a waiter waits for the holders of conflicting locks and
+the conflicting waiters ahead of it. A cycle in the graph is a deadlock, the youngest transaction
+in the cycle (greatest ID) is the victim.
+Only transactions of this process are queued and in the graph, waiting for locks held by other
+processes ends when they are released or by timeout.
+*/
+
+package transaction
+
+import (
+	"strconv"
+	"sync"
+	"time"
+	"constant"
+	"table"
+	"st"
+	"logg"
+)
+
+// A transaction waiting for a table or row lock.
+type waiter struct {
+	id       int64
+	mode     int
+	blockers []int64 // transactions which the waiter waits for
+}
+
+var (
+	waitMutex sync.Mutex                   // protects queues, waiting and released
+	queues    = make(map[string][]*waiter) // table path and name (#row) -> waiters in order of arrival
+	waiting   = make(map[int64]*waiter)    // transaction ID -> its waiter
+	released  = make(chan bool)            // closed (and replaced) when waiters should try again
+)
+
+// Returns true if the transaction has locked the table.
+func (tr *Transaction) holds(t *table.Table) bool {
+	for _, locked := range tr.Locked {
+		if locked == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Locks a table (row is NoRow) or a row in a mode, waits up to LockTimeout if other transactions hold
+// or wait for conflicting locks.
+func (tr *Transaction) wait(t *table.Table, row, mode int) int {
+	conflict := conflictStatus(mode)
+	key := t.Path + t.Name
+	if row != NoRow {
+		key += "#" + strconv.Itoa(row)
+	}
+	// Locks already held must not expire while waiting.
+	status := tr.renewIfDue()
+	if status != st.OK {
+		return status
+	}
+	deadline := time.Nanoseconds() + tr.LockTimeout
+	waitMutex.Lock()
+	w := &waiter{tr.id, mode, make([]int64, 0)}
+	queues[key] = append(queues[key], w)
+	waiting[tr.id] = w
+	waitMutex.Unlock()
+	for {
+		waitMutex.Lock()
+		blockers := make([]int64, 0)
+		if row != NoRow || !tr.holds(t) {
+			blockers = ahead(queues[key], w)
+		}
+		// Taken before trying, a release meanwhile is not missed.
+		wakeup := released
+		waitMutex.Unlock()
+		holders := make([]int64, 0)
+		if len(blockers) == 0 {
+			holders, status = tr.tryLock(t, row, mode)
+			if status != conflict {
+				break
+			}
+		}
+		waitMutex.Lock()
+		w.blockers = append(blockers, holders...)
+		victim := deadlockVictim(w)
+		waitMutex.Unlock()
+		if victim == tr.id {
+			status = st.Deadlock
+			break
+		}
+		now := time.Nanoseconds()
+		if now >= deadline {
+			status = conflict
+			break
+		}
+		status = tr.renewIfDue()
+		if status != st.OK {
+			break
+		}
+		interval := int64(constant.LockPollInterval)
+		if deadline-now < interval {
+			interval = deadline - now
+		}
+		select {
+		case <-wakeup:
+		case <-time.After(interval):
+		}
+	}
+	waitMutex.Lock()
+	leave(key, w)
+	waitMutex.Unlock()
+	if status == st.Deadlock {
+		logg.Warn("transaction", "wait", "Transaction "+tr.ID+" is the victim of deadlock on "+key)
+	}
+	return status
+}
+
+// Tells the waiting transactions to try again, e.g. after locks are released.
+func wakeWaiters() {
+	waitMutex.Lock()
+	defer waitMutex.Unlock()
+	wake()
+}
+
+// Wakes up the waiting transactions, waitMutex must be held.
+func wake() {
+	close(released)
+	released = make(chan bool)
+}
+
+// Returns the waiters ahead of w in the queue whose requests conflict with w's request.
+func ahead(queue []*waiter, w *waiter) []int64 {
+	ids := make([]int64, 0)
+	for _, other := range queue {
+		if other == w {
+			break
+		}
+		if !compatible(other.mode, w.mode) {
+			ids = append(ids, other.id)
+		}
+	}
+	return ids
+}
+
+// Removes a waiter from the queue, waiters behind it may go ahead. waitMutex must be held.
+func leave(key string, w *waiter) {
+	queue := queues[key]
+	for i, other := range queue {
+		if other == w {
+			queue = append(queue[:i], queue[i+1:]...)
+			break
+		}
+	}
+	if len(queue) == 0 {
+		queues[key] = nil, false
+	} else {
+		queues[key] = queue
+	}
+	waiting[w.id] = nil, false
+	wake()
+}
+
+// Returns the victim of the deadlock which the waiter is in, or 0 if the waiter is not in a deadlock.
+func deadlockVictim(w *waiter) int64 {
+	// Search for a path in the wait-for graph from the waiter back to itself.
+	path := []int64{w.id}
+	visited := make(map[int64]bool)
+	var search func(id int64) bool
+	search = func(id int64) bool {
+		current, isWaiting := waiting[id]
+		if !isWaiting || visited[id] {
+			return false
+		}
+		visited[id] = true
+		for _, blocker := range current.blockers {
+			if blocker == w.id {
+				return true
+			}
+			path = append(path, blocker)
+			if search(blocker) {
+				return true
+			}
+			path = path[:len(path)-1]
+		}
+		return false
+	}
+	if !search(w.id) {
+		return 0
+	}
+	victim := w.id
+	for _, id := range path {
+		if id > victim {
+			victim = id
+		}
+	}
+	return victim
+}
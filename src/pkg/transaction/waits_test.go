@@ -0,0 +1,81 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package transaction
+
+import (
+	"fmt"
+	"testing"
+)
+
+var deadlockTests = []struct {
+	name   string
+	graph  map[int64][]int64 // waiting transaction -> its blockers
+	id     int64             // the waiter which looks for a deadlock
+	victim int64
+}{
+	{"no blockers", map[int64][]int64{1: {}}, 1, 0},
+	{"blocker is not waiting", map[int64][]int64{1: {2}}, 1, 0},
+	{"chain", map[int64][]int64{1: {2}, 2: {3}, 3: {}}, 1, 0},
+	{"two", map[int64][]int64{1: {2}, 2: {1}}, 1, 2},
+	{"two, found by the victim", map[int64][]int64{1: {2}, 2: {1}}, 2, 2},
+	{"three", map[int64][]int64{5: {3}, 3: {9}, 9: {5}}, 3, 9},
+	// 7 waits for a cycle which it is not in, the others look for it.
+	{"cycle elsewhere", map[int64][]int64{7: {1}, 1: {2}, 2: {1}}, 7, 0},
+	{"cycle through the second blocker", map[int64][]int64{1: {4, 2}, 4: {}, 2: {3}, 3: {1}}, 1, 3},
+	// Transactions outside the cycle are never the victim.
+	{"branch", map[int64][]int64{1: {8, 2}, 8: {9}, 9: {}, 2: {1}}, 1, 2},
+}
+
+func TestDeadlockVictim(t *testing.T) {
+	defer func(saved map[int64]*waiter) { waiting = saved }(waiting)
+	for _, test := range deadlockTests {
+		waiting = make(map[int64]*waiter)
+		for id, blockers := range test.graph {
+			waiting[id] = &waiter{id, Exclusive, blockers}
+		}
+		if victim := deadlockVictim(waiting[test.id]); victim != test.victim {
+			t.Errorf("%s: victim is %d, want %d", test.name, victim, test.victim)
+		}
+	}
+}
+
+var aheadTests = []struct {
+	modes    []int // modes of the queue, the last waiter is tested
+	blockers []int64
+}{
+	{[]int{Exclusive}, []int64{}},
+	{[]int{Shared, Shared, Shared}, []int64{}},
+	{[]int{Exclusive, Shared, Shared}, []int64{1}},
+	{[]int{Shared, IntentionShared, Exclusive}, []int64{1, 2}},
+	{[]int{IntentionExclusive, IntentionShared, Shared}, []int64{1}},
+	{[]int{Shared, IntentionExclusive, IntentionShared}, []int64{}},
+}
+
+func TestAhead(t *testing.T) {
+	for _, test := range aheadTests {
+		queue := make([]*waiter, len(test.modes))
+		for i, mode := range test.modes {
+			queue[i] = &waiter{int64(i + 1), mode, nil}
+		}
+		blockers := ahead(queue, queue[len(queue)-1])
+		if fmt.Sprint(blockers) != fmt.Sprint(test.blockers) {
+			t.Errorf("queue %v: blockers are %v, want %v", test.modes, blockers, test.blockers)
+		}
+	}
+}
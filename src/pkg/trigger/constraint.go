@@ -27,7 +27,11 @@ import (
 )
 
 // Look for a value in a table's column, returns true if the value is found. 
+// Deleted rows are not looked at.
 func find(column, value string, t *table.Table) (bool, int) {
+	if t.Index(column) != nil {
+		return findInIndex(column, value, t)
+	}
 	numberOfRows, status := t.NumberOfRows()
 	if status != st.OK {
 		return false, status
@@ -37,6 +41,31 @@ func find(column, value string, t *table.Table) (bool, int) {
 		if status != st.OK {
 			return false, status
 		}
+		if row["~del"] != "y" && row[column] == value {
+			return true, st.OK
+		}
+	}
+	return false, st.OK
+}
+
+// Look for a value in a table's column using index of the column.
+func findInIndex(column, value string, t *table.Table) (bool, int) {
+	key, valid := t.IndexKey(column, value)
+	if !valid {
+		// The value cannot be stored in the column at all.
+		return false, st.OK
+	}
+	rowNumbers, status := t.Index(column).Lookup(key)
+	if status != st.OK {
+		return false, status
+	}
+	// Keys are encoded values (e.g. "018" and "18" in an int column are the same key),
+	// thus compare the values as well.
+	for _, rowNumber := range rowNumbers {
+		row, status := t.Read(rowNumber)
+		if status != st.OK {
+			return false, status
+		}
 		if row[column] == value {
 			return true, st.OK
 		}
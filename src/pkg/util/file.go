@@ -22,7 +22,9 @@ package util
 
 import (
 	"os"
+	"strconv"
 	"strings"
+	"constant"
 	"st"
 	"logg"
 )
@@ -43,6 +45,24 @@ func CreateAndWrite(filename, content string) int {
 	return st.OK
 }
 
+// Writes the content into a temporary file and renames it to the file, so that readers of the file
+// see either the old or the new content. The temporary file name contains ThePrefix.
+func WriteAndRename(filename, content string) int {
+	tempName := filename + constant.ThePrefix + strconv.Itoa(os.Getpid())
+	status := CreateAndWrite(tempName, content)
+	if status != st.OK {
+		os.Remove(tempName)
+		return status
+	}
+	err := os.Rename(tempName, filename)
+	if err != nil {
+		logg.Err("util", "WriteAndRename", err)
+		os.Remove(tempName)
+		return st.CannotCreateFile
+	}
+	return st.OK
+}
+
 // Removes a line's occurances from a file.
 func RemoveLine(filename, line string) int {
 	// Open and read the file.
@@ -0,0 +1,49 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/* Some utility functions for telling processes apart. */
+
+package util
+
+import (
+	"os"
+	"syscall"
+	"logg"
+)
+
+// Name of this host, or empty if it cannot be determined.
+var hostname string
+
+func init() {
+	var err os.Error
+	hostname, err = os.Hostname()
+	if err != nil {
+		logg.Warn("util", "init", "Cannot get host name, processes on this host cannot be told apart")
+	}
+}
+
+// Returns the name of this host, or empty if it cannot be determined.
+func Hostname() string {
+	return hostname
+}
+
+// Returns true if a process is running on this host.
+func Alive(pid int) bool {
+	// Signal 0 only checks whether the process exists.
+	return syscall.Kill(pid, 0) != syscall.ESRCH
+}
@@ -0,0 +1,247 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/* Recover the database after a crash by undoing unfinished transactions in the write-ahead log. */
+
+package wal
+
+import (
+	"os"
+	"strings"
+	"strconv"
+	"table"
+	"st"
+	"logg"
+)
+
+// An undo record read from the log.
+type record struct {
+	recordType, tableName string
+	rowNumber             int
+	original              map[string]string
+}
+
+// A transaction which has not committed or rolled back according to the log.
+type unfinished struct {
+	pid     int // process running the transaction, 0 if unknown (logged by older version)
+	host    string
+	records []*record
+}
+
+// Reads a log file. Returns the IDs of unfinished transactions in the order they began, and the
+// transactions by ID.
+func readLog(path string) ([]string, map[string]*unfinished, int) {
+	order := make([]string, 0)
+	transactions := make(map[string]*unfinished)
+	file, err := os.Open(path)
+	if err != nil {
+		// There is nothing to recover if the log does not exist.
+		return order, transactions, st.OK
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		logg.Err("wal", "readLog", err.String())
+		return nil, nil, st.CannotReadWALFile
+	}
+	buffer := make([]byte, fi.Size)
+	_, err = file.Read(buffer)
+	if err != nil && fi.Size > 0 {
+		logg.Err("wal", "readLog", err.String())
+		return nil, nil, st.CannotReadWALFile
+	}
+	// Collect undo records of each transaction, in the order they were written.
+	for _, line := range strings.Split(string(buffer), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		parts, status := fields(line)
+		if status != st.OK || len(parts) < 2 {
+			// The last record may be incompletely written when crash happened.
+			logg.Warn("wal", "readLog", "Ignored malformed record "+line)
+			continue
+		}
+		id := parts[0]
+		if parts[1] == Commit || parts[1] == Abort {
+			transactions[id] = nil, false
+			continue
+		}
+		// A transaction may be used again after it commits or rolls back.
+		tr, exists := transactions[id]
+		if !exists {
+			tr = &unfinished{records: make([]*record, 0)}
+			transactions[id] = tr
+			order = append(order[:], id)
+		}
+		if parts[1] == Begin {
+			if len(parts) == 4 {
+				tr.pid, _ = strconv.Atoi(parts[2])
+				tr.host = parts[3]
+			}
+			continue
+		}
+		if len(parts) < 4 {
+			logg.Warn("wal", "readLog", "Ignored malformed record "+line)
+			continue
+		}
+		rowNumber, err := strconv.Atoi(parts[3])
+		if err != nil {
+			logg.Warn("wal", "readLog", "Ignored malformed record "+line)
+			continue
+		}
+		rec := &record{recordType: parts[1], tableName: parts[2], rowNumber: rowNumber}
+		if rec.recordType == Update {
+			rec.original = make(map[string]string)
+			for i := 4; i+1 < len(parts); i += 2 {
+				rec.original[parts[i]] = parts[i+1]
+			}
+		}
+		tr.records = append(tr.records, rec)
+	}
+	return order, transactions, st.OK
+}
+
+// Undoes the unfinished transactions, latest first, and flushes the tables.
+// Indexes of the tables changed by the transactions are re-created, they may not have been written
+// when crash happened.
+func undoAll(order []string, transactions map[string]*unfinished, tables map[string]*table.Table) int {
+	touched := make(map[string]*table.Table)
+	for i := len(order) - 1; i >= 0; i-- {
+		tr, exists := transactions[order[i]]
+		if !exists {
+			continue
+		}
+		logg.Warn("wal", "undoAll", "Rolling back unfinished transaction "+order[i])
+		for j := len(tr.records) - 1; j >= 0; j-- {
+			status := tr.records[j].undo(tables)
+			if status != st.OK {
+				return status
+			}
+			if t, exists := tables[tr.records[j].tableName]; exists {
+				touched[t.Name] = t
+			}
+		}
+		transactions[order[i]] = nil, false
+	}
+	for _, t := range tables {
+		status := t.Flush()
+		if status != st.OK {
+			return status
+		}
+	}
+	for _, t := range touched {
+		status := t.RebuildIndexes()
+		if status != st.OK {
+			return status
+		}
+	}
+	return st.OK
+}
+
+// Reads the log file of the database in the path and undoes the changes made by unfinished transactions.
+// The log file is emptied afterwards.
+func Recover(path string, tables map[string]*table.Table) int {
+	if _, err := os.Stat(path + ".wal"); err != nil {
+		// There is nothing to recover if the log does not exist.
+		return st.OK
+	}
+	order, transactions, status := readLog(path + ".wal")
+	if status != st.OK {
+		return status
+	}
+	status = undoAll(order, transactions, tables)
+	if status != st.OK {
+		return status
+	}
+	// All transactions are finished, the log is no longer needed.
+	err := os.Truncate(path+".wal", 0)
+	if err != nil {
+		logg.Err("wal", "Recover", err.String())
+		return st.CannotWriteWALFile
+	}
+	return st.OK
+}
+
+// Undoes the unfinished transactions of a process which no longer has the database open,
+// and logs them rolled back.
+func (log *Log) RecoverProcess(pid int, host string, tables map[string]*table.Table) int {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	order, transactions, status := readLog(log.Path)
+	if status != st.OK {
+		return status
+	}
+	for id, tr := range transactions {
+		if tr.pid != pid || tr.host != host || log.active[id] {
+			transactions[id] = nil, false
+		}
+	}
+	ids := make([]string, 0)
+	for id := range transactions {
+		ids = append(ids[:], id)
+	}
+	status = undoAll(order, transactions, tables)
+	if status != st.OK {
+		return status
+	}
+	for _, id := range ids {
+		if e := log.append(id, Abort); e != nil {
+			return e.Code
+		}
+	}
+	return st.OK
+}
+
+// Undoes the change logged by an undo record.
+func (rec *record) undo(tables map[string]*table.Table) int {
+	t, exists := tables[rec.tableName]
+	if !exists {
+		logg.Warn("wal", "undo", "Table "+rec.tableName+" no longer exists")
+		return st.OK
+	}
+	// Get rid of incompletely written row at the end of table.
+	fi, err := t.DataFile.Stat()
+	if err != nil {
+		logg.Err("wal", "undo", err.String())
+		return st.CannotStatTableDataFile
+	}
+	if fi.Size%int64(t.RowLength) != 0 {
+		err = t.DataFile.Truncate(fi.Size - fi.Size%int64(t.RowLength))
+		if err != nil {
+			logg.Err("wal", "undo", err.String())
+			return st.CannotWriteTableDataFile
+		}
+	}
+	numberOfRows, status := t.NumberOfRows()
+	if status != st.OK {
+		return status
+	}
+	// The change may not have been made when crash happened.
+	if rec.rowNumber >= numberOfRows {
+		return st.OK
+	}
+	switch rec.recordType {
+	case Insert:
+		return t.Delete(rec.rowNumber)
+	case Update:
+		return t.Update(rec.rowNumber, rec.original)
+	case Delete:
+		return t.Update(rec.rowNumber, map[string]string{"~del": "", "~deleter": ""})
+	}
+	return st.OK
+}
@@ -0,0 +1,141 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package wal
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"column"
+	"constant"
+	"table"
+	"tablefilemanager"
+	"st"
+)
+
+// Creates table PERSON (NAME indexed, AGE) having the rows in a new temporary directory.
+func person(t *testing.T, rows ...[]string) (string, *table.Table) {
+	dir, err := ioutil.TempDir("", constant.TemporaryDirPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir += "/"
+	if e := tablefilemanager.Create(dir, "PERSON"); e != nil {
+		t.Fatal(e)
+	}
+	p, status := table.Open(dir, "PERSON")
+	if status != st.OK {
+		t.Fatal(p.Err())
+	}
+	for name, length := range constant.DatabaseColumns() {
+		p.Add(name, length)
+	}
+	p.Add("NAME", 10)
+	p.AddTyped("AGE", 3, column.Int)
+	for _, row := range rows {
+		if status = p.Insert(map[string]string{"NAME": row[0], "AGE": row[1]}); status != st.OK {
+			t.Fatal(p.Err())
+		}
+	}
+	if status = p.CreateIndex("NAME"); status != st.OK {
+		t.Fatal(p.Err())
+	}
+	return dir, p
+}
+
+var recoverTests = []struct {
+	name   string
+	change func(log *Log, p *table.Table) // logs and makes changes, then "crashes"
+	rows   [][]string                     // NAME, AGE and ~del of each row after recovery
+}{
+	{"unfinished insert", func(log *Log, p *table.Table) {
+		log.Insert("1", "PERSON", 2)
+		p.Insert(map[string]string{"NAME": "NIKKI", "AGE": "20"})
+	}, [][]string{{"BUZZ", "18", ""}, {"JOSHUA", "30", ""}, {"NIKKI", "20", "y"}}},
+	{"unfinished update", func(log *Log, p *table.Table) {
+		log.Update("1", "PERSON", 0, map[string]string{"NAME": "BUZZ", "AGE": "18"})
+		p.Update(0, map[string]string{"NAME": "NIKKI", "AGE": "20"})
+	}, [][]string{{"BUZZ", "18", ""}, {"JOSHUA", "30", ""}}},
+	{"unfinished delete", func(log *Log, p *table.Table) {
+		log.Delete("1", "PERSON", 1)
+		p.Delete(1)
+	}, [][]string{{"BUZZ", "18", ""}, {"JOSHUA", "30", ""}}},
+	{"committed update", func(log *Log, p *table.Table) {
+		log.Update("1", "PERSON", 0, map[string]string{"NAME": "BUZZ"})
+		p.Update(0, map[string]string{"NAME": "NIKKI"})
+		log.Commit("1")
+	}, [][]string{{"NIKKI", "18", ""}, {"JOSHUA", "30", ""}}},
+	{"rolled back delete", func(log *Log, p *table.Table) {
+		log.Delete("1", "PERSON", 1)
+		p.Delete(1)
+		p.Update(1, map[string]string{"~del": ""})
+		log.Abort("1")
+	}, [][]string{{"BUZZ", "18", ""}, {"JOSHUA", "30", ""}}},
+	{"latest transaction first", func(log *Log, p *table.Table) {
+		log.Update("1", "PERSON", 0, map[string]string{"NAME": "BUZZ"})
+		p.Update(0, map[string]string{"NAME": "NIKKI"})
+		log.Update("2", "PERSON", 0, map[string]string{"NAME": "NIKKI"})
+		p.Update(0, map[string]string{"NAME": "CHRISTINA"})
+	}, [][]string{{"BUZZ", "18", ""}, {"JOSHUA", "30", ""}}},
+	{"change not made", func(log *Log, p *table.Table) {
+		log.Insert("1", "PERSON", 2)
+	}, [][]string{{"BUZZ", "18", ""}, {"JOSHUA", "30", ""}}},
+}
+
+func TestRecover(t *testing.T) {
+	for _, test := range recoverTests {
+		dir, p := person(t, []string{"BUZZ", "18"}, []string{"JOSHUA", "30"})
+		log, status := Open(dir)
+		if status != st.OK {
+			t.Fatalf("%s: cannot open log: %s", test.name, st.New(status))
+		}
+		test.change(log, p)
+		log.File.Close()
+		status = Recover(dir, map[string]*table.Table{"PERSON": p})
+		if status != st.OK {
+			t.Errorf("%s: Recover returned %s", test.name, st.New(status))
+		}
+		numberOfRows, _ := p.NumberOfRows()
+		if numberOfRows != len(test.rows) {
+			t.Errorf("%s: %d rows, want %d", test.name, numberOfRows, len(test.rows))
+		}
+		for i, want := range test.rows {
+			row, status := p.Read(i)
+			if status != st.OK {
+				t.Errorf("%s: cannot read row %d: %s", test.name, i, st.New(status))
+				continue
+			}
+			if row["NAME"] != want[0] || row["AGE"] != want[1] || row["~del"] != want[2] {
+				t.Errorf("%s: row %d is %v, want %v", test.name, i, row, want)
+			}
+			// The index has the live rows only.
+			key, _ := p.IndexKey("NAME", want[0])
+			found, _ := p.Index("NAME").Lookup(key)
+			indexed := len(found) == 1 && found[0] == i
+			if indexed != (want[2] == "") {
+				t.Errorf("%s: index has rows %v of %s", test.name, found, want[0])
+			}
+		}
+		if fi, err := os.Stat(dir + ".wal"); err != nil || fi.Size != 0 {
+			t.Errorf("%s: log is not emptied", test.name)
+		}
+		p.Close()
+		os.RemoveAll(dir)
+	}
+}
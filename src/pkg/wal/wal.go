@@ -0,0 +1,220 @@
+/*
+<DBGo - A flat-file relational database engine implementation in Go programming language>
+Copyright (C) <2011>  <Houzuo (Howard) Guo>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+/*
+Write-ahead log of a database.
+
+Before a table is changed by a transaction, an undo record is appended to the log file
+".wal" in database directory and the log file is flushed to disk. When a transaction
+commits, its changed tables are flushed before the commit record is written.
+Thus, when the database is opened after a crash, the changes of transactions which
+did not commit or roll back are undone according to the undo records in the log.
+
+Each line in the log file is a record, e.g.
+
+1321234567890123456 BEGIN 4242 "myhost"
+1321234567890123456 IN "PERSON" 12
+1321234567890123456 UP "PERSON" 3 "NAME" "BUZZ" "AGE" "18"
+1321234567890123456 DE "PERSON" 4
+1321234567890123456 COMMIT
+
+The BEGIN record names the process (PID and host) running the transaction, so that the unfinished
+transactions of a process which leaves the database without finishing them are undone by the other
+processes (see RecoverProcess).
+The log file is emptied when none of the transactions is in progress, unless other processes
+may be writing the log or the log has unfinished transactions of processes which have left.
+A Log is safe for concurrent use by transactions running in different goroutines.
+*/
+
+package wal
+
+import (
+	"os"
+	"strings"
+	"strconv"
+	"sync"
+	"constant"
+	"st"
+	"util"
+	"logg"
+)
+
+// Record types.
+const (
+	Begin  = "BEGIN"
+	Insert = "IN"
+	Update = "UP"
+	Delete = "DE"
+	Commit = "COMMIT"
+	Abort  = "ABORT"
+)
+
+type Log struct {
+	Path   string // path to the log file
+	File   *os.File
+	active map[string]bool // IDs of transactions in progress
+	mutex  sync.Mutex
+	// Returns true if other processes may write the log, nil if none does.
+	Shared func() bool
+}
+
+// Opens (or creates) the write-ahead log of a database.
+func Open(path string) (*Log, int) {
+	log := &Log{Path: path + ".wal", active: make(map[string]bool)}
+	var err os.Error
+	log.File, err = os.OpenFile(log.Path, os.O_RDWR|os.O_APPEND|os.O_CREATE, constant.WALFilePerm)
+	if err != nil {
+		logg.Err("wal", "Open", err.String())
+		return nil, st.CannotOpenWALFile
+	}
+	return log, st.OK
+}
+
+// Appends a record to the log and flushes the log file.
+func (log *Log) append(id string, fields ...string) *st.Error {
+	_, err := log.File.WriteString(id + " " + strings.Join(fields, " ") + "\n")
+	if err != nil {
+		logg.Err("wal", "append", err.String())
+		return st.Wrap(st.CannotWriteWALFile, err)
+	}
+	err = log.File.Sync()
+	if err != nil {
+		logg.Err("wal", "append", err.String())
+		return st.Wrap(st.CannotWriteWALFile, err)
+	}
+	return nil
+}
+
+// Logs the process running a transaction before its first undo record.
+func (log *Log) begin(id string) *st.Error {
+	if log.active[id] {
+		return nil
+	}
+	log.active[id] = true
+	return log.append(id, Begin, strconv.Itoa(os.Getpid()), strconv.Quote(util.Hostname()))
+}
+
+// Logs an undo record of a row in a table, the error names the table and row.
+func (log *Log) undo(id, tableName string, rowNumber int, fields ...string) *st.Error {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	e := log.begin(id)
+	if e == nil {
+		e = log.append(id, fields...)
+	}
+	if e != nil {
+		return e.WithTable(tableName).WithRow(rowNumber)
+	}
+	return nil
+}
+
+// Logs a row about to be inserted into a table.
+func (log *Log) Insert(id, tableName string, rowNumber int) *st.Error {
+	return log.undo(id, tableName, rowNumber, Insert, strconv.Quote(tableName), strconv.Itoa(rowNumber))
+}
+
+// Logs the original values of a row about to be updated.
+func (log *Log) Update(id, tableName string, rowNumber int, original map[string]string) *st.Error {
+	fields := []string{Update, strconv.Quote(tableName), strconv.Itoa(rowNumber)}
+	for name, value := range original {
+		fields = append(fields[:], strconv.Quote(name), strconv.Quote(value))
+	}
+	return log.undo(id, tableName, rowNumber, fields...)
+}
+
+// Logs a row about to be deleted.
+func (log *Log) Delete(id, tableName string, rowNumber int) *st.Error {
+	return log.undo(id, tableName, rowNumber, Delete, strconv.Quote(tableName), strconv.Itoa(rowNumber))
+}
+
+// Logs that a transaction has committed.
+func (log *Log) Commit(id string) *st.Error {
+	return log.end(id, Commit)
+}
+
+// Logs that a transaction has rolled back.
+func (log *Log) Abort(id string) *st.Error {
+	return log.end(id, Abort)
+}
+
+// Logs the end of a transaction, empties the log if no more transaction is in progress.
+func (log *Log) end(id, recordType string) *st.Error {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	e := log.append(id, recordType)
+	if e != nil {
+		return e
+	}
+	log.active[id] = false, false
+	if len(log.active) == 0 && (log.Shared == nil || !log.Shared()) {
+		// Transactions of processes which have left unfinished are undone when the database is opened next.
+		_, transactions, status := readLog(log.Path)
+		if status != st.OK {
+			return st.New(status)
+		}
+		if len(transactions) > 0 {
+			logg.Warn("wal", "end", "The log has unfinished transactions of other processes and is kept")
+			return nil
+		}
+		err := log.File.Truncate(0)
+		if err != nil {
+			logg.Err("wal", "end", err.String())
+			return st.Wrap(st.CannotWriteWALFile, err)
+		}
+	}
+	return nil
+}
+
+// Splits a record into fields, quoted fields are unquoted.
+func fields(record string) ([]string, int) {
+	result := make([]string, 0)
+	for {
+		record = strings.TrimLeft(record, " ")
+		if record == "" {
+			break
+		}
+		var end int
+		if record[0] == '"' {
+			// Look for the closing quote which is not escaped.
+			for end = 1; end < len(record); end++ {
+				if record[end] == '\\' {
+					end++
+				} else if record[end] == '"' {
+					break
+				}
+			}
+			if end >= len(record) {
+				return nil, st.InvalidWALRecord
+			}
+			end++
+			field, err := strconv.Unquote(record[:end])
+			if err != nil {
+				return nil, st.InvalidWALRecord
+			}
+			result = append(result[:], field)
+		} else {
+			end = strings.Index(record, " ")
+			if end == -1 {
+				end = len(record)
+			}
+			result = append(result[:], record[:end])
+		}
+		record = record[end:]
+	}
+	return result, st.OK
+}